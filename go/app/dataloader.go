@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The defaults of batchLoader, which are short enough not to be noticed in a request
+// while collecting the keys of the fields resolved concurrently, e.g. the categories of a list of items.
+const (
+	defaultLoaderWait     = 2 * time.Millisecond
+	defaultLoaderMaxBatch = 100
+)
+
+// batchLoader collects the keys loaded within wait of each other and fetches them in one call,
+// so that resolving a field of every element of a list doesn't query the database once per element.
+// The results are cached for the lifetime of the loader, which is a request.
+type batchLoader[K comparable, V any] struct {
+	// fetch returns the values of keys. The keys without a value are left out of the map.
+	fetch    func(ctx context.Context, keys []K) (map[K]V, error)
+	wait     time.Duration
+	maxBatch int
+
+	mu    sync.Mutex
+	cache map[K]*loaderBatch[K, V]
+	// pending is the batch collecting keys. It is nil until the next key is loaded.
+	pending *loaderBatch[K, V]
+}
+
+// loaderBatch is the keys fetched together, whose results are set when done is closed.
+type loaderBatch[K comparable, V any] struct {
+	keys []K
+	// dispatched is set when the batch stops collecting keys, guarded by the mutex of the loader.
+	dispatched bool
+	done       chan struct{}
+	values     map[K]V
+	err        error
+}
+
+func newBatchLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:    fetch,
+		wait:     defaultLoaderWait,
+		maxBatch: defaultLoaderMaxBatch,
+		cache:    make(map[K]*loaderBatch[K, V]),
+	}
+}
+
+// Load returns the value of key, and false when fetch didn't return one.
+func (l *batchLoader[K, V]) Load(ctx context.Context, key K) (V, bool, error) {
+	l.mu.Lock()
+	b, ok := l.cache[key]
+	if !ok {
+		b = l.pending
+		if b == nil {
+			b = &loaderBatch[K, V]{done: make(chan struct{})}
+			l.pending = b
+			// the batch is fetched with a context which outlives the load starting it,
+			// as the other loads waiting for it may be canceled independently
+			fetchCtx := context.WithoutCancel(ctx)
+			time.AfterFunc(l.wait, func() { l.dispatch(fetchCtx, b) })
+		}
+		b.keys = append(b.keys, key)
+		l.cache[key] = b
+		if len(b.keys) >= l.maxBatch {
+			// the full batch is closed right away, so that the next keys start another one
+			l.pending = nil
+			b.dispatched = true
+			go l.run(context.WithoutCancel(ctx), b)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		var zero V
+		return zero, false, ctx.Err()
+	}
+	if b.err != nil {
+		var zero V
+		return zero, false, b.err
+	}
+	v, ok := b.values[key]
+	return v, ok, nil
+}
+
+// dispatch fetches the keys of b when the wait is over, unless the batch was filled and fetched before.
+func (l *batchLoader[K, V]) dispatch(ctx context.Context, b *loaderBatch[K, V]) {
+	l.mu.Lock()
+	if b.dispatched {
+		l.mu.Unlock()
+		return
+	}
+	b.dispatched = true
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.run(ctx, b)
+}
+
+// run fetches the keys of b and wakes up the loads waiting for them.
+func (l *batchLoader[K, V]) run(ctx context.Context, b *loaderBatch[K, V]) {
+	b.values, b.err = l.fetch(ctx, b.keys)
+	if b.err != nil {
+		// the failed keys are fetched again by the next loads
+		l.mu.Lock()
+		for _, key := range b.keys {
+			if l.cache[key] == b {
+				delete(l.cache, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+	close(b.done)
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBatchLoader(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var mu sync.Mutex
+	var batches [][]int
+	fail := true
+	l := newBatchLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, slices.Sorted(slices.Values(keys)))
+		if slices.Contains(keys, 0) && fail {
+			fail = false
+			return nil, errors.New("failed")
+		}
+		values := make(map[int]string)
+		for _, k := range keys {
+			if k%2 == 1 {
+				values[k] = "odd"
+			}
+		}
+		return values, nil
+	})
+	// long enough for the loads below to join one batch even on slow machines
+	l.wait = 50 * time.Millisecond
+	l.maxBatch = 3
+
+	load := func(keys ...int) []string {
+		got := make([]string, len(keys))
+		var wg sync.WaitGroup
+		for i, k := range keys {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, ok, err := l.Load(ctx, k)
+				switch {
+				case err != nil:
+					got[i] = "error"
+				case !ok:
+					got[i] = "missing"
+				default:
+					got[i] = v
+				}
+			}()
+		}
+		wg.Wait()
+		return got
+	}
+
+	if diff := cmp.Diff([]string{"odd", "missing", "odd", "odd"}, load(1, 2, 1, 3)); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+	// the cached keys aren't fetched again, and the batches are split at maxBatch
+	if diff := cmp.Diff([]string{"odd", "missing", "odd", "missing", "odd"}, load(1, 4, 5, 6, 7)); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+	// the failed keys are fetched again by the next load
+	if diff := cmp.Diff([]string{"error"}, load(0)); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"missing"}, load(0)); diff != "" {
+		t.Errorf("unexpected values (-want +got):\n%s", diff)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var fetched []int
+	for _, b := range batches {
+		fetched = append(fetched, b...)
+	}
+	slices.Sort(fetched)
+	if diff := cmp.Diff([]int{0, 0, 1, 2, 3, 4, 5, 6, 7}, fetched); diff != "" {
+		t.Errorf("unexpected fetched keys (-want +got):\n%s", diff)
+	}
+	if len(batches) != 5 {
+		t.Errorf("expected 5 batches, got %v", batches)
+	}
+}
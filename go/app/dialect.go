@@ -0,0 +1,60 @@
+package app
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// dialect is the flavor of SQL spoken by a database.
+// Queries are written with `?` placeholders and syntax common to every dialect,
+// and the few differences are filled in by the methods of dialect.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// rebind rewrites the `?` placeholders of query into the style of the dialect, e.g. `$1` for PostgreSQL.
+// Question marks inside string literals are kept as is.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// forUpdate returns the clause to lock the selected rows until the transaction ends.
+// SQLite has no row locks, and transactions already take the write lock when they begin.
+func (d dialect) forUpdate() string {
+	if d == dialectPostgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// isUniqueViolation reports whether err is a violation of a unique constraint, which PostgreSQL reports as SQLSTATE 23505.
+// SQLite is never detected, as its transactions take the write lock when they begin, so a check before writing holds.
+func (d dialect) isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return d == dialectPostgres && errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
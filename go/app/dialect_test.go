@@ -0,0 +1,86 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRebind(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		dialect dialect
+		query   string
+		want    string
+	}{
+		"sqlite keeps question marks": {
+			dialect: dialectSQLite,
+			query:   "SELECT id FROM items WHERE id = ? AND name = ?",
+			want:    "SELECT id FROM items WHERE id = ? AND name = ?",
+		},
+		"postgres numbers placeholders": {
+			dialect: dialectPostgres,
+			query:   "SELECT id FROM items WHERE id = ? AND name = ?",
+			want:    "SELECT id FROM items WHERE id = $1 AND name = $2",
+		},
+		"postgres keeps question marks in literals": {
+			dialect: dialectPostgres,
+			query:   "SELECT id FROM items WHERE name = 'why?' AND id = ?",
+			want:    "SELECT id FROM items WHERE name = 'why?' AND id = $1",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.dialect.rebind(tc.query); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		dialect dialect
+		err     error
+		want    bool
+	}{
+		"postgres unique violation": {
+			dialect: dialectPostgres,
+			err:     fmt.Errorf("failed to update: %w", &pgconn.PgError{Code: "23505"}),
+			want:    true,
+		},
+		"postgres foreign key violation": {
+			dialect: dialectPostgres,
+			err:     &pgconn.PgError{Code: "23503"},
+			want:    false,
+		},
+		"other errors": {
+			dialect: dialectPostgres,
+			err:     errors.New("connection refused"),
+			want:    false,
+		},
+		"sqlite": {
+			dialect: dialectSQLite,
+			err:     &pgconn.PgError{Code: "23505"},
+			want:    false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.dialect.isUniqueViolation(tc.err); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
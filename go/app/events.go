@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The types of ItemEvent.
+const (
+	itemEventCreated = "item.created"
+	// itemEventUpdated is published when the images of an item are added, reordered or deleted.
+	itemEventUpdated = "item.updated"
+	itemEventDeleted = "item.deleted"
+)
+
+// The defaults of eventBroker.
+const (
+	// defaultEventHistory is the number of the latest events kept to be replayed to the clients resuming a stream.
+	defaultEventHistory = 256
+	// defaultSubscriberBuffer is the number of the events waiting for a client, beyond which the client is evicted.
+	defaultSubscriberBuffer = 64
+)
+
+// ItemEvent is a change of an item published to the clients of the streams.
+type ItemEvent struct {
+	// ID increases with each event. Clients resume from it with Last-Event-ID.
+	ID   uint64
+	Type string
+	// Item is the item after the change without the image URLs, which depend on the version each subscriber calls.
+	// It must not be modified, as it is shared by the subscribers.
+	Item *Item
+}
+
+// eventBroker delivers the events published in this process to the subscribers.
+// Each subscriber has a buffer, and the subscribers which don't keep up with the events are evicted
+// instead of blocking the publishers. They are expected to resume with the ID of the last event they got.
+type eventBroker struct {
+	bufferSize int
+
+	mu     sync.Mutex
+	lastID uint64
+	// history is the latest events in the order of their IDs, up to its capacity.
+	history     []ItemEvent
+	subscribers map[*eventSubscription]struct{}
+}
+
+// eventSubscription receives the events published after it subscribed.
+type eventSubscription struct {
+	// startID is the ID of the last event published before the subscription, which isn't sent to events.
+	startID uint64
+	events  chan ItemEvent
+	// evicted is closed when the subscription fell behind and no more events are sent.
+	evicted chan struct{}
+}
+
+// newEventBroker creates a broker keeping historySize events.
+// The IDs start from the current time in microseconds, so that they keep increasing across restarts
+// and the clients resuming with an ID of a previous process get every event of this one.
+func newEventBroker(historySize, bufferSize int) *eventBroker {
+	return &eventBroker{
+		bufferSize:  bufferSize,
+		lastID:      uint64(time.Now().UnixMicro()),
+		history:     make([]ItemEvent, 0, historySize),
+		subscribers: make(map[*eventSubscription]struct{}),
+	}
+}
+
+// Publish assigns the next ID to the event and sends it to the subscribers.
+func (b *eventBroker) Publish(eventType string, item *Item) ItemEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := ItemEvent{ID: b.lastID, Type: eventType, Item: item}
+	if cap(b.history) > 0 {
+		if len(b.history) == cap(b.history) {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			b.evict(sub)
+		}
+	}
+	return event
+}
+
+// Subscribe starts a subscription. The events after lastID which are still in the history are returned as well,
+// and the ones which were dropped from the history are lost. lastID is zero for new clients.
+func (b *eventBroker) Subscribe(lastID uint64) (*eventSubscription, []ItemEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []ItemEvent
+	if lastID != 0 {
+		missed = b.since(lastID)
+	}
+
+	sub := &eventSubscription{startID: b.lastID, events: make(chan ItemEvent, b.bufferSize), evicted: make(chan struct{})}
+	b.subscribers[sub] = struct{}{}
+	return sub, missed
+}
+
+// History returns the events after lastID which are still in the history.
+func (b *eventBroker) History(lastID uint64) []ItemEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.since(lastID)
+}
+
+// since returns the events of the history after lastID. The caller must hold the lock.
+func (b *eventBroker) since(lastID uint64) []ItemEvent {
+	var events []ItemEvent
+	for _, event := range b.history {
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Unsubscribe stops a subscription, which may have been evicted already.
+func (b *eventBroker) Unsubscribe(sub *eventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, sub)
+}
+
+// evict stops sending events to a subscription. The caller must hold the lock.
+func (b *eventBroker) evict(sub *eventSubscription) {
+	delete(b.subscribers, sub)
+	close(sub.evicted)
+}
+
+// publishingItemRepository publishes the events of the items written through the repository.
+// The events of the writes in a transaction of TxManager are published after it is committed.
+// The items of the updates and the deletions are read back in the same transaction, so that the events carry their state after the write.
+type publishingItemRepository struct {
+	ItemRepository
+	// publish is called with a copy of the written item, so that the caller may keep modifying it.
+	publish func(eventType string, item *Item)
+}
+
+func (p *publishingItemRepository) Insert(ctx context.Context, item *Item) error {
+	if err := p.ItemRepository.Insert(ctx, item); err != nil {
+		return err
+	}
+	inserted := cloneItem(item)
+	runAfterCommit(ctx, func() { p.publish(itemEventCreated, inserted) })
+	return nil
+}
+
+func (p *publishingItemRepository) Delete(ctx context.Context, id int) error {
+	if err := p.ItemRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	p.publishByID(ctx, itemEventDeleted, id)
+	return nil
+}
+
+func (p *publishingItemRepository) AddImages(ctx context.Context, itemID int, imageNames []string) ([]*ItemImage, error) {
+	images, err := p.ItemRepository.AddImages(ctx, itemID, imageNames)
+	if err != nil {
+		return nil, err
+	}
+	p.publishByID(ctx, itemEventUpdated, itemID)
+	return images, nil
+}
+
+func (p *publishingItemRepository) ReorderImages(ctx context.Context, itemID int, imageIDs []int) ([]*ItemImage, error) {
+	images, err := p.ItemRepository.ReorderImages(ctx, itemID, imageIDs)
+	if err != nil {
+		return nil, err
+	}
+	p.publishByID(ctx, itemEventUpdated, itemID)
+	return images, nil
+}
+
+func (p *publishingItemRepository) DeleteImage(ctx context.Context, itemID int, imageID int) ([]*ItemImage, error) {
+	images, err := p.ItemRepository.DeleteImage(ctx, itemID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	p.publishByID(ctx, itemEventUpdated, itemID)
+	return images, nil
+}
+
+// publishByID reads the item written by a successful write and publishes it.
+// The write isn't failed when the item can't be read, as it may have been done outside a transaction already.
+func (p *publishingItemRepository) publishByID(ctx context.Context, eventType string, id int) {
+	item, err := p.ItemRepository.GetByID(ctx, strconv.Itoa(id), ItemQuery{IncludeDeleted: true})
+	if err != nil {
+		slog.Error("failed to read item to publish: ", "error", err, "event", eventType, "id", id)
+		return
+	}
+	runAfterCommit(ctx, func() { p.publish(eventType, item) })
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// eventNames returns the names of the items of events.
+func eventNames(events []ItemEvent) []string {
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Item.Name)
+	}
+	return names
+}
+
+// receiveEvents takes the events waiting for sub without blocking.
+func receiveEvents(sub *eventSubscription) []ItemEvent {
+	var events []ItemEvent
+	for {
+		select {
+		case event := <-sub.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventBroker(t *testing.T) {
+	t.Parallel()
+
+	b := newEventBroker(3, 2)
+	fast, _ := b.Subscribe(0)
+	slow, _ := b.Subscribe(0)
+
+	var published []ItemEvent
+	for _, name := range []string{"jacket", "hat"} {
+		published = append(published, b.Publish(itemEventCreated, &Item{Name: name}))
+	}
+	if published[1].ID != published[0].ID+1 {
+		t.Errorf("expected increasing IDs, got %d and %d", published[0].ID, published[1].ID)
+	}
+	if diff := cmp.Diff([]string{"jacket", "hat"}, eventNames(receiveEvents(fast))); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// the buffer of slow is full, so it is evicted instead of blocking the publisher
+	published = append(published, b.Publish(itemEventCreated, &Item{Name: "scarf"}))
+	select {
+	case <-slow.evicted:
+	default:
+		t.Fatal("expected the slow subscriber to be evicted")
+	}
+	select {
+	case <-fast.evicted:
+		t.Fatal("expected the fast subscriber to be kept")
+	default:
+	}
+	if diff := cmp.Diff([]string{"scarf"}, eventNames(receiveEvents(fast))); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+	b.Unsubscribe(fast)
+	b.Unsubscribe(slow)
+
+	// the evicted subscriber resumes from the last event it got
+	published = append(published, b.Publish(itemEventCreated, &Item{Name: "boots"}))
+	cases := map[string]struct {
+		lastID uint64
+		want   []string
+	}{
+		"new client": {
+			lastID: 0,
+		},
+		"resumes after the last event": {
+			lastID: published[1].ID,
+			want:   []string{"scarf", "boots"},
+		},
+		"loses the events dropped from the history": {
+			lastID: published[0].ID - 1,
+			want:   []string{"hat", "scarf", "boots"},
+		},
+		"up to date": {
+			lastID: published[3].ID,
+		},
+	}
+	for name, tt := range cases {
+		sub, missed := b.Subscribe(tt.lastID)
+		b.Unsubscribe(sub)
+		if diff := cmp.Diff(tt.want, eventNames(missed)); diff != "" {
+			t.Errorf("%s: unexpected events (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+func TestPublishingItemRepositoryE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	ctx := context.Background()
+	storage := setupSQLiteStorage(t, StorageConfig{})
+	var published []string
+	items := &publishingItemRepository{ItemRepository: storage.Items, publish: func(eventType string, item *Item) {
+		published = append(published, eventType+":"+item.Name)
+	}}
+	phone := &Category{Name: "phone"}
+	if err := storage.Categories.Create(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	err := storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"}); err != nil {
+			return err
+		}
+		// the insert of a rolled back savepoint isn't published
+		_ = storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := items.Insert(ctx, &Item{Name: "Pixel", CategoryID: phone.ID, Image: "b.jpg"}); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		if len(published) > 0 {
+			t.Errorf("expected the events to wait for the commit, got %v", published)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the insert of a rolled back transaction isn't published
+	err = storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := items.Insert(ctx, &Item{Name: "Galaxy", CategoryID: phone.ID, Image: "c.jpg"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected %v, got %v", errFailed, err)
+	}
+	// the insert outside transactions is published right away
+	if err := items.Insert(ctx, &Item{Name: "Xperia", CategoryID: phone.ID, Image: "d.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := items.Insert(ctx, &Item{Name: "unknown", CategoryID: phone.ID + 100, Image: "e.jpg"}); !errors.Is(err, errCategoryNotFound) {
+		t.Errorf("expected %v, got %v", errCategoryNotFound, err)
+	}
+
+	if diff := cmp.Diff([]string{"item.created:iPhone", "item.created:Xperia"}, published); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// the updates and the deletions are published with the item after the write
+	published = nil
+	xperia := &Item{Name: "Xperia 1", CategoryID: phone.ID, Image: "f.jpg"}
+	err = storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := items.Insert(ctx, xperia); err != nil {
+			return err
+		}
+		if _, err := items.AddImages(ctx, xperia.ID, []string{"g.jpg"}); err != nil {
+			return err
+		}
+		return items.Delete(ctx, xperia.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := items.Delete(ctx, xperia.ID); !errors.Is(err, errItemNotFound) {
+		t.Errorf("expected %v, got %v", errItemNotFound, err)
+	}
+	if diff := cmp.Diff([]string{"item.created:Xperia 1", "item.updated:Xperia 1", "item.deleted:Xperia 1"}, published); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+}
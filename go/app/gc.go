@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultImageGCGracePeriod is how long a newly stored image is protected from the garbage collection.
+const DefaultImageGCGracePeriod = time.Hour
+
+// ImageGC removes image files which are no longer referenced by any item.
+// It works as a mark-and-sweep: the referenced names are collected from the repository,
+// then every other image file in the directory is removed.
+// As storeImage deduplicates images by their hash, a file is kept as long as at least one item refers to it.
+type ImageGC struct {
+	// ImgDirPath is the path to the directory storing images.
+	ImgDirPath string
+	ItemRepo   ItemRepository
+	// GracePeriod protects files modified recently,
+	// e.g. an image stored by POST /items whose item has not been inserted yet.
+	// storeImage renews the modification time when it stores a file which already exists.
+	GracePeriod time.Duration
+	// DryRun reports the files to remove without removing them.
+	DryRun bool
+}
+
+// ImageGCResult is the result of a garbage collection.
+type ImageGCResult struct {
+	// Scanned is the number of image files found in the directory.
+	Scanned int
+	// Removed is the list of orphaned files. They are not removed in dry-run mode.
+	Removed []string
+}
+
+// Run runs the garbage collection once.
+func (g *ImageGC) Run(ctx context.Context) (*ImageGCResult, error) {
+	// mark
+	names, err := g.ItemRepo.ImageNames(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referenced images: %w", err)
+	}
+	referenced := make(map[string]bool, len(names))
+	for _, name := range names {
+		referenced[filepath.Base(name)] = true
+	}
+
+	// sweep
+	entries, err := os.ReadDir(g.ImgDirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image directory: %w", err)
+	}
+	result := &ImageGCResult{}
+	threshold := time.Now().Add(-g.GracePeriod)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == "default.jpg" || !isImageFileName(name) {
+			continue
+		}
+		result.Scanned++
+		if referenced[name] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(threshold) {
+			continue
+		}
+
+		if !g.DryRun {
+			err := os.Remove(filepath.Join(g.ImgDirPath, name))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove image: %w", err)
+			}
+		}
+		result.Removed = append(result.Removed, name)
+	}
+	return result, nil
+}
+
+// RunPeriodically runs the garbage collection every interval until ctx is done.
+func (g *ImageGC) RunPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := g.Run(ctx)
+			if err != nil {
+				slog.Error("failed to collect orphaned images: ", "error", err)
+				continue
+			}
+			slog.Info("collected orphaned images", "scanned", result.Scanned, "removed", len(result.Removed), "dry_run", g.DryRun)
+		}
+	}
+}
+
+func isImageFileName(name string) bool {
+	return strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg")
+}
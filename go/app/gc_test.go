@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestImageGC(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		removed   []string
+		remaining []string
+	}
+	cases := map[string]struct {
+		dryRun bool
+		wants
+	}{
+		"ok: orphaned images are removed": {
+			wants: wants{
+				removed:   []string{"orphan.jpg"},
+				remaining: []string{"default.jpg", "new.jpg", "notes.txt", "shared.jpg", "used.jpg"},
+			},
+		},
+		"ok: dry run keeps every file": {
+			dryRun: true,
+			wants: wants{
+				removed:   []string{"orphan.jpg"},
+				remaining: []string{"default.jpg", "new.jpg", "notes.txt", "orphan.jpg", "shared.jpg", "used.jpg"},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			imgDir := t.TempDir()
+			old := time.Now().Add(-2 * time.Hour)
+			for _, f := range []string{"default.jpg", "used.jpg", "shared.jpg", "orphan.jpg", "notes.txt"} {
+				p := filepath.Join(imgDir, f)
+				if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(p, old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// stored recently, so the item referring to it may not be inserted yet
+			if err := os.WriteFile(filepath.Join(imgDir, "new.jpg"), []byte("new"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			mockIR.EXPECT().ImageNames(gomock.Any()).Return([]string{"images/used.jpg", "shared.jpg"}, nil)
+
+			gc := &ImageGC{
+				ImgDirPath:  imgDir,
+				ItemRepo:    mockIR,
+				GracePeriod: time.Hour,
+				DryRun:      tt.dryRun,
+			}
+			result, err := gc.Run(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if result.Scanned != 4 {
+				t.Errorf("expected 4 scanned images, got %d", result.Scanned)
+			}
+			if diff := cmp.Diff(tt.wants.removed, result.Removed); diff != "" {
+				t.Errorf("unexpected removed images (-want +got):\n%s", diff)
+			}
+
+			entries, err := os.ReadDir(imgDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var remaining []string
+			for _, e := range entries {
+				remaining = append(remaining, e.Name())
+			}
+			sort.Strings(remaining)
+			if diff := cmp.Diff(tt.wants.remaining, remaining); diff != "" {
+				t.Errorf("unexpected remaining files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImageGCOfReuploadedImage(t *testing.T) {
+	t.Parallel()
+
+	imgDir := t.TempDir()
+	h := &Handlers{imgDirPath: imgDir}
+	name, err := h.storeImage([]byte("jacket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an orphan stored long ago, e.g. by a listing which was never inserted
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(imgDir, filepath.Base(name)), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same image is uploaded again for a new listing, which isn't inserted yet
+	reuploaded, err := h.storeImage([]byte("jacket"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reuploaded != name {
+		t.Fatalf("expected the deduplicated name %q, got %q", name, reuploaded)
+	}
+
+	ctrl := gomock.NewController(t)
+	mockIR := NewMockItemRepository(ctrl)
+	mockIR.EXPECT().ImageNames(gomock.Any()).Return(nil, nil)
+	gc := &ImageGC{ImgDirPath: imgDir, ItemRepo: mockIR, GracePeriod: time.Hour}
+	result, err := gc.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 0 {
+		t.Errorf("expected the re-uploaded image to be kept, got %v removed", result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(imgDir, filepath.Base(name))); err != nil {
+		t.Errorf("expected the re-uploaded image to remain: %v", err)
+	}
+}
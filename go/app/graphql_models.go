@@ -0,0 +1,93 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type CreateCategoryInput struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parentId,omitempty"`
+}
+
+type CreateItemInput struct {
+	Name string `json:"name"`
+	// Either categoryId, or category which is the slug or the name of the category, is required.
+	CategoryID *int    `json:"categoryId,omitempty"`
+	Category   *string `json:"category,omitempty"`
+	// The IDs returned by POST /uploads.
+	ImageIds []string `json:"imageIds"`
+}
+
+type CreateItemPayload struct {
+	Item *Item `json:"item"`
+	// The items with a near-duplicate cover image.
+	SimilarItemIds []int `json:"similarItemIds"`
+}
+
+type Mutation struct {
+}
+
+type Query struct {
+}
+
+type ItemSort string
+
+const (
+	// By ID.
+	ItemSortID ItemSort = "ID"
+	// By creation time in descending order.
+	ItemSortNewest ItemSort = "NEWEST"
+)
+
+var AllItemSort = []ItemSort{
+	ItemSortID,
+	ItemSortNewest,
+}
+
+func (e ItemSort) IsValid() bool {
+	switch e {
+	case ItemSortID, ItemSortNewest:
+		return true
+	}
+	return false
+}
+
+func (e ItemSort) String() string {
+	return string(e)
+}
+
+func (e *ItemSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ItemSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ItemSort", str)
+	}
+	return nil
+}
+
+func (e ItemSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ItemSort) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ItemSort) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
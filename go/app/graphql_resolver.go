@@ -0,0 +1,6 @@
+package app
+
+// graphqlResolver resolves the operations of /graphql with the repositories and the item logic of the HTTP handlers.
+type graphqlResolver struct {
+	h *Handlers
+}
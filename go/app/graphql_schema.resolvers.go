@@ -0,0 +1,172 @@
+package app
+
+// This file will be automatically regenerated based on the schema, any resolver
+// implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.86
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+)
+
+// Parent is the resolver for the parent field.
+func (r *categoryGraphqlResolver) Parent(ctx context.Context, obj *Category) (*Category, error) {
+	if obj.ParentID == nil {
+		return nil, nil
+	}
+	parent, _, err := loadersFromContext(ctx).categories.Load(ctx, *obj.ParentID)
+	return parent, err
+}
+
+// Items is the resolver for the items field.
+func (r *categoryGraphqlResolver) Items(ctx context.Context, obj *Category, sort *ItemSort) ([]*Item, error) {
+	items, _, err := loadersFromContext(ctx).categoryItems.Load(ctx, categoryItemsKey{categoryID: obj.ID, newest: sort != nil && *sort == ItemSortNewest})
+	return items, err
+}
+
+// Category is the resolver for the category field.
+func (r *itemGraphqlResolver) Category(ctx context.Context, obj *Item) (*Category, error) {
+	category, ok, err := loadersFromContext(ctx).categories.Load(ctx, obj.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errCategoryNotFound
+	}
+	return category, nil
+}
+
+// CreateItem is the resolver for the createItem field.
+func (r *mutationGraphqlResolver) CreateItem(ctx context.Context, input CreateItemInput) (*CreateItemPayload, error) {
+	req := &AddItemRequest{Name: input.Name, ImageIDs: input.ImageIds}
+	if input.CategoryID != nil {
+		req.CategoryID = *input.CategoryID
+	}
+	if input.Category != nil {
+		req.Category = *input.Category
+	}
+	if err := req.validate(); err != nil {
+		return nil, graphqlError(ctx, graphqlBadUserInput, err)
+	}
+
+	item, similar, err := r.h.addItem(ctx, req)
+	if err != nil {
+		if errors.Is(err, errImageNotFound) || errors.Is(err, errCategoryNotFound) {
+			return nil, graphqlError(ctx, graphqlBadUserInput, err)
+		}
+		slog.Error("failed to add item: ", "error", err)
+		return nil, err
+	}
+
+	r.h.setImageURLs(ctx, item)
+	payload := &CreateItemPayload{Item: item, SimilarItemIds: []int{}}
+	for _, si := range similar {
+		payload.SimilarItemIds = append(payload.SimilarItemIds, si.ID)
+	}
+	return payload, nil
+}
+
+// DeleteItem is the resolver for the deleteItem field.
+func (r *mutationGraphqlResolver) DeleteItem(ctx context.Context, id int) (bool, error) {
+	if !r.h.isGraphQLAdmin(ctx) {
+		return false, graphqlError(ctx, graphqlForbidden, errors.New("items are only deleted by admins"))
+	}
+	err := r.h.itemRepo.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, errItemNotFound) {
+			return false, graphqlError(ctx, graphqlBadUserInput, err)
+		}
+		slog.Error("failed to delete item: ", "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateCategory is the resolver for the createCategory field.
+func (r *mutationGraphqlResolver) CreateCategory(ctx context.Context, input CreateCategoryInput) (*Category, error) {
+	category := &Category{Name: input.Name, ParentID: input.ParentID}
+	err := r.h.categoryRepo.Create(ctx, category)
+	if err != nil {
+		if errors.Is(err, errCategoryExists) || errors.Is(err, errInvalidCategoryName) || errors.Is(err, errParentCategoryNotFound) {
+			return nil, graphqlError(ctx, graphqlBadUserInput, err)
+		}
+		slog.Error("failed to manage category: ", "error", err)
+		return nil, err
+	}
+	return category, nil
+}
+
+// Items is the resolver for the items field.
+func (r *queryGraphqlResolver) Items(ctx context.Context, sort *ItemSort, includeDeleted *bool) ([]*Item, error) {
+	query := ItemQuery{
+		Newest:         sort != nil && *sort == ItemSortNewest,
+		IncludeDeleted: includeDeleted != nil && *includeDeleted,
+	}
+	if query.IncludeDeleted && !r.h.isGraphQLAdmin(ctx) {
+		return nil, graphqlError(ctx, graphqlForbidden, errors.New("includeDeleted is only allowed for admins"))
+	}
+
+	resp, err := r.h.itemRepo.GetAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	r.h.setImageURLs(ctx, resp.Items...)
+	return resp.Items, nil
+}
+
+// Item is the resolver for the item field.
+func (r *queryGraphqlResolver) Item(ctx context.Context, id int) (*Item, error) {
+	item, err := r.h.itemRepo.GetByID(ctx, strconv.Itoa(id), ItemQuery{})
+	if errors.Is(err, errItemNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.h.setImageURLs(ctx, item)
+	return item, nil
+}
+
+// SearchItems is the resolver for the searchItems field.
+func (r *queryGraphqlResolver) SearchItems(ctx context.Context, keyword string) ([]*Item, error) {
+	if keyword == "" {
+		return nil, graphqlError(ctx, graphqlBadUserInput, errors.New("keyword is required"))
+	}
+	resp, err := r.h.itemRepo.Search(ctx, keyword, ItemQuery{})
+	if err != nil {
+		return nil, err
+	}
+	r.h.setImageURLs(ctx, resp.Items...)
+	return resp.Items, nil
+}
+
+// Categories is the resolver for the categories field.
+func (r *queryGraphqlResolver) Categories(ctx context.Context) ([]*Category, error) {
+	return r.h.categoryRepo.GetAll(ctx)
+}
+
+// Category is the resolver for the category field.
+func (r *queryGraphqlResolver) Category(ctx context.Context, id int) (*Category, error) {
+	category, _, err := loadersFromContext(ctx).categories.Load(ctx, id)
+	return category, err
+}
+
+// Category returns CategoryResolver implementation.
+func (r *graphqlResolver) Category() CategoryResolver { return &categoryGraphqlResolver{r} }
+
+// Item returns ItemResolver implementation.
+func (r *graphqlResolver) Item() ItemResolver { return &itemGraphqlResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *graphqlResolver) Mutation() MutationResolver { return &mutationGraphqlResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *graphqlResolver) Query() QueryResolver { return &queryGraphqlResolver{r} }
+
+type categoryGraphqlResolver struct{ *graphqlResolver }
+type itemGraphqlResolver struct{ *graphqlResolver }
+type mutationGraphqlResolver struct{ *graphqlResolver }
+type queryGraphqlResolver struct{ *graphqlResolver }
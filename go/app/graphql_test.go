@@ -0,0 +1,373 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingCategoryRepository counts the lookups of categories to tell batched loads from one query per item.
+type countingCategoryRepository struct {
+	CategoryRepository
+	getByID  atomic.Int32
+	getByIDs atomic.Int32
+}
+
+func (c *countingCategoryRepository) GetByID(ctx context.Context, id int) (*Category, error) {
+	c.getByID.Add(1)
+	return c.CategoryRepository.GetByID(ctx, id)
+}
+
+func (c *countingCategoryRepository) GetByIDs(ctx context.Context, ids []int) ([]*Category, error) {
+	c.getByIDs.Add(1)
+	return c.CategoryRepository.GetByIDs(ctx, ids)
+}
+
+// countingItemRepository counts the lookups of the items of categories to tell batched loads from one query per category.
+type countingItemRepository struct {
+	ItemRepository
+	getByCategory   atomic.Int32
+	getByCategories atomic.Int32
+}
+
+func (c *countingItemRepository) GetByCategory(ctx context.Context, categoryID int, query ItemQuery) (*ItemsWrapper, error) {
+	c.getByCategory.Add(1)
+	return c.ItemRepository.GetByCategory(ctx, categoryID, query)
+}
+
+func (c *countingItemRepository) GetByCategories(ctx context.Context, categoryIDs []int, query ItemQuery) (map[int][]*Item, error) {
+	c.getByCategories.Add(1)
+	return c.ItemRepository.GetByCategories(ctx, categoryIDs, query)
+}
+
+// graphqlResult is a response of /graphql whose data is decoded by each test.
+type graphqlResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []*GraphQLError `json:"errors"`
+}
+
+// errorCode returns the code of the first error, or an empty string when the operation succeeded.
+func (r graphqlResult) errorCode() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// doGraphQL sends req with POST, or in the query with GET, and decodes the response.
+func doGraphQL(t *testing.T, mux http.Handler, method string, req GraphQLRequest, header http.Header) (int, graphqlResult) {
+	t.Helper()
+
+	var r *http.Request
+	if method == http.MethodGet {
+		params := url.Values{}
+		if req.Query != "" {
+			params.Set("query", req.Query)
+		}
+		if req.Extensions != nil {
+			extensions, err := json.Marshal(req.Extensions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params.Set("extensions", string(extensions))
+		}
+		r = httptest.NewRequest(method, "/v1/graphql?"+params.Encode(), nil)
+	} else {
+		body, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = httptest.NewRequest(method, "/v1/graphql", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, r)
+	var res graphqlResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return rr.Code, res
+}
+
+func TestGraphQL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	memoryItems, memoryCategories := NewMemoryRepositories()
+	itemRepo := &countingItemRepository{ItemRepository: memoryItems}
+	categoryRepo := &countingCategoryRepository{CategoryRepository: memoryCategories}
+	h := &Handlers{imgDirPath: t.TempDir(), publicBaseURL: "https://api.example.com", adminToken: "secret", itemRepo: itemRepo, categoryRepo: categoryRepo}
+	mux := newValidatedMux(t, h)
+
+	fashion := &Category{Name: "fashion"}
+	if err := categoryRepo.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+	jackets := &Category{Name: "jackets", ParentID: &fashion.ID}
+	if err := categoryRepo.Create(ctx, jackets); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*Item{
+		{Name: "jacket", CategoryID: jackets.ID, Image: "a.jpg"},
+		{Name: "denim jacket", CategoryID: jackets.ID, Image: "b.jpg"},
+		{Name: "scarf", CategoryID: fashion.ID, Image: "c.jpg"},
+		{Name: "old scarf", CategoryID: fashion.ID, Image: "d.jpg"},
+	} {
+		if err := itemRepo.Insert(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := &Item{Name: "torn jacket", CategoryID: jackets.ID, Image: "e.jpg"}
+	if err := itemRepo.Insert(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := itemRepo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("batches the categories of items", func(t *testing.T) {
+		code, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{
+			Query: `{ items { name imageUrl category { name parent { name } } } }`,
+		}, nil)
+		if code != http.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("unexpected response %d: %v", code, res.Errors)
+		}
+
+		type category struct {
+			Name   string    `json:"name"`
+			Parent *category `json:"parent"`
+		}
+		var got struct {
+			Items []struct {
+				Name     string   `json:"name"`
+				ImageURL string   `json:"imageUrl"`
+				Category category `json:"category"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(res.Data, &got); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, item := range got.Items {
+			names = append(names, item.Name+":"+item.Category.Name)
+		}
+		if diff := cmp.Diff([]string{"jacket:jackets", "denim jacket:jackets", "scarf:fashion", "old scarf:fashion"}, names); diff != "" {
+			t.Errorf("unexpected items (-want +got):\n%s", diff)
+		}
+		if parent := got.Items[0].Category.Parent; parent == nil || parent.Name != "fashion" {
+			t.Errorf("expected the parent of jackets to be fashion, got %v", parent)
+		}
+		if got.Items[0].ImageURL != "https://api.example.com/v1/images/a.jpg" {
+			t.Errorf("unexpected image URL %q", got.Items[0].ImageURL)
+		}
+
+		// the categories and their parents are looked up in batches instead of once per item
+		if n := categoryRepo.getByIDs.Load(); n == 0 || n >= int32(len(got.Items)) {
+			t.Errorf("expected fewer batched lookups than the %d items, got %d", len(got.Items), n)
+		}
+		if n := categoryRepo.getByID.Load(); n != 0 {
+			t.Errorf("expected no lookups of single categories, got %d", n)
+		}
+	})
+
+	t.Run("batches the items of categories", func(t *testing.T) {
+		code, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{
+			Query: `{ categories { name items(sort: NEWEST) { name } } }`,
+		}, nil)
+		if code != http.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("unexpected response %d: %v", code, res.Errors)
+		}
+
+		var got struct {
+			Categories []struct {
+				Name  string `json:"name"`
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+			} `json:"categories"`
+		}
+		if err := json.Unmarshal(res.Data, &got); err != nil {
+			t.Fatal(err)
+		}
+		names := map[string][]string{}
+		for _, category := range got.Categories {
+			for _, item := range category.Items {
+				names[category.Name] = append(names[category.Name], item.Name)
+			}
+		}
+		want := map[string][]string{
+			"fashion": {"old scarf", "scarf", "denim jacket", "jacket"},
+			"jackets": {"denim jacket", "jacket"},
+		}
+		if diff := cmp.Diff(want, names); diff != "" {
+			t.Errorf("unexpected items (-want +got):\n%s", diff)
+		}
+
+		// the items of every category are looked up in a single call
+		if n := itemRepo.getByCategories.Load(); n != 1 {
+			t.Errorf("expected a single lookup of the items of %d categories, got %d", len(got.Categories), n)
+		}
+		if n := itemRepo.getByCategory.Load(); n != 0 {
+			t.Errorf("expected no lookups of single categories, got %d", n)
+		}
+	})
+
+	t.Run("includeDeleted", func(t *testing.T) {
+		cases := map[string]struct {
+			header http.Header
+			want   int
+			code   string
+		}{
+			"ok: admin": {
+				header: http.Header{"Authorization": {"Bearer secret"}},
+				want:   5,
+			},
+			"ng: others": {
+				code: graphqlForbidden,
+			},
+		}
+		for name, tt := range cases {
+			_, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{Query: `{ items(includeDeleted: true) { id } }`}, tt.header)
+			if res.errorCode() != tt.code {
+				t.Errorf("%s: expected error code %q, got %v", name, tt.code, res.Errors)
+				continue
+			}
+			var got struct {
+				Items []struct{ ID string } `json:"items"`
+			}
+			if err := json.Unmarshal(res.Data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Items) != tt.want {
+				t.Errorf("%s: expected %d items, got %d", name, tt.want, len(got.Items))
+			}
+		}
+	})
+
+	t.Run("mutations", func(t *testing.T) {
+		imageID, err := h.storeImage([]byte("hat.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mutation := `mutation($input: CreateItemInput!) { createItem(input: $input) { item { name category { slug } images { url } } similarItemIds } }`
+
+		code, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{
+			Query:     mutation,
+			Variables: map[string]any{"input": map[string]any{"name": "hat", "category": "Fashion", "imageIds": []string{imageID}}},
+		}, nil)
+		if code != http.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("unexpected response %d: %v", code, res.Errors)
+		}
+		want := `{"createItem":{"item":{"name":"hat","category":{"slug":"fashion"},"images":[{"url":"https://api.example.com/v1/images/` + imageID + `"}]},"similarItemIds":[]}}`
+		if diff := cmp.Diff(want, string(res.Data)); diff != "" {
+			t.Errorf("unexpected data (-want +got):\n%s", diff)
+		}
+
+		cases := map[string]map[string]any{
+			"ng: no image":         {"name": "hat", "categoryId": fashion.ID, "imageIds": []string{}},
+			"ng: unknown image ID": {"name": "hat", "categoryId": fashion.ID, "imageIds": []string{"missing.jpg"}},
+			"ng: unknown category": {"name": "hat", "category": "books", "imageIds": []string{imageID}},
+		}
+		for name, input := range cases {
+			_, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{Query: mutation, Variables: map[string]any{"input": input}}, nil)
+			if res.errorCode() != graphqlBadUserInput {
+				t.Errorf("%s: expected %s, got %v", name, graphqlBadUserInput, res.Errors)
+			}
+		}
+
+		// mutations aren't run with GET, which may be cached or prefetched
+		code, _ = doGraphQL(t, mux, http.MethodGet, GraphQLRequest{Query: `mutation { deleteItem(id: 1) }`}, nil)
+		if code != http.StatusNotAcceptable {
+			t.Errorf("expected status code %d for a mutation with GET, got %d", http.StatusNotAcceptable, code)
+		}
+	})
+
+	t.Run("deleteItem is only allowed for admins", func(t *testing.T) {
+		mutation := `mutation { deleteItem(id: ` + strconv.Itoa(deleted.ID) + `) }`
+		cases := map[string]struct {
+			header http.Header
+			code   string
+		}{
+			// the item is deleted already, so that the other subtests see the same items
+			"ok: admin": {
+				header: http.Header{"Authorization": {"Bearer secret"}},
+				code:   graphqlBadUserInput,
+			},
+			"ng: others": {
+				code: graphqlForbidden,
+			},
+		}
+		for name, tt := range cases {
+			_, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{Query: mutation}, tt.header)
+			if res.errorCode() != tt.code {
+				t.Errorf("%s: expected error code %q, got %v", name, tt.code, res.Errors)
+			}
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		cases := map[string]struct {
+			query string
+			code  string
+		}{
+			"ok: introspection isn't counted": {
+				query: `{ __schema { types { fields { type { ofType { ofType { ofType { name } } } } } } } }`,
+			},
+			"ng: too deep": {
+				query: `{ categories { parent { parent { parent { parent { parent { name } } } } } } }`,
+				code:  graphqlDepthExceeded,
+			},
+			"ng: too deep in fragments": {
+				query: `{ categories { ...p } } fragment p on Category { parent { parent { parent { parent { parent { name } } } } } }`,
+				code:  graphqlDepthExceeded,
+			},
+			"ng: too complex": {
+				query: `{ items { images { id } category { items { images { id } } } } }`,
+				code:  "COMPLEXITY_LIMIT_EXCEEDED",
+			},
+		}
+		for name, tt := range cases {
+			_, res := doGraphQL(t, mux, http.MethodPost, GraphQLRequest{Query: tt.query}, nil)
+			if res.errorCode() != tt.code {
+				t.Errorf("%s: expected error code %q, got %v", name, tt.code, res.Errors)
+			}
+		}
+	})
+
+	t.Run("persisted queries", func(t *testing.T) {
+		query := `{ category(id: ` + strconv.Itoa(jackets.ID) + `) { name } }`
+		hash := sha256.Sum256([]byte(query))
+		extensions := map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(hash[:])}}
+
+		_, res := doGraphQL(t, mux, http.MethodGet, GraphQLRequest{Extensions: extensions}, nil)
+		if res.errorCode() != "PERSISTED_QUERY_NOT_FOUND" {
+			t.Fatalf("expected the unknown hash to be rejected, got %v", res.Errors)
+		}
+
+		// the query is registered once with its hash and run by the hash after that
+		for _, req := range []GraphQLRequest{{Query: query, Extensions: extensions}, {Extensions: extensions}} {
+			code, res := doGraphQL(t, mux, http.MethodGet, req, nil)
+			if code != http.StatusOK || len(res.Errors) > 0 {
+				t.Fatalf("unexpected response %d: %v", code, res.Errors)
+			}
+			if diff := cmp.Diff(`{"category":{"name":"jackets"}}`, string(res.Data)); diff != "" {
+				t.Errorf("unexpected data (-want +got):\n%s", diff)
+			}
+		}
+	})
+}
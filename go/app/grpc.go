@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	catalogv1 "mercari-build-training/gen/catalog/v1"
+)
+
+// The Go code of proto/catalog/v1/catalog.proto is generated into gen/catalog/v1 by buf with the plugins in the tools of go.mod.
+//go:generate sh -c "cd .. && go tool buf generate"
+
+// catalogServer implements the gRPC CatalogService with the repositories and the item logic of the HTTP handlers.
+type catalogServer struct {
+	catalogv1.UnimplementedCatalogServiceServer
+	h *Handlers
+}
+
+// newGRPCServer returns the gRPC server of the catalog, which is served on a separate port from the HTTP API.
+func newGRPCServer(h *Handlers) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logUnaryRPC),
+		grpc.ChainStreamInterceptor(logStreamRPC),
+	)
+	catalogv1.RegisterCatalogServiceServer(srv, &catalogServer{h: h})
+	return srv
+}
+
+// logUnaryRPC logs the unary calls like simpleLoggerMiddleware.
+func logUnaryRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	slog.Info("rpc received", "method", info.FullMethod)
+	return handler(ctx, req)
+}
+
+// logStreamRPC logs the streaming calls like simpleLoggerMiddleware.
+func logStreamRPC(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	slog.Info("rpc received", "method", info.FullMethod)
+	return handler(srv, ss)
+}
+
+// itemQuery converts the query of a request. Only admins can include soft-deleted items like the HTTP API.
+func (c *catalogServer) itemQuery(ctx context.Context, q *catalogv1.ItemQuery) (ItemQuery, error) {
+	query := ItemQuery{
+		Newest:         q.GetOrder() == catalogv1.ItemOrder_ITEM_ORDER_NEWEST,
+		IncludeDeleted: q.GetIncludeDeleted(),
+	}
+	if query.IncludeDeleted && !c.isAdmin(ctx) {
+		return query, status.Error(codes.PermissionDenied, "include_deleted is only allowed for admins")
+	}
+	return query, nil
+}
+
+// isAdmin reports whether the call has the admin bearer token in the authorization metadata.
+func (c *catalogServer) isAdmin(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if c.h.isAdminAuthorization(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListItems streams the items, in a category and its descendants when category_id is set.
+func (c *catalogServer) ListItems(req *catalogv1.ListItemsRequest, stream catalogv1.CatalogService_ListItemsServer) error {
+	ctx := stream.Context()
+	query, err := c.itemQuery(ctx, req.GetQuery())
+	if err != nil {
+		return err
+	}
+
+	var resp *ItemsWrapper
+	if req.GetCategoryId() != 0 {
+		resp, err = c.h.itemRepo.GetByCategory(ctx, int(req.GetCategoryId()), query)
+	} else {
+		resp, err = c.h.itemRepo.GetAll(ctx, query)
+	}
+	if err != nil {
+		return itemStatusError(err)
+	}
+
+	c.h.setImageURLs(ctx, resp.Items...)
+	for _, item := range resp.Items {
+		if err := stream.Send(&catalogv1.ListItemsResponse{Item: toProtoItem(item)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetItem returns an item.
+func (c *catalogServer) GetItem(ctx context.Context, req *catalogv1.GetItemRequest) (*catalogv1.GetItemResponse, error) {
+	query, err := c.itemQuery(ctx, req.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+	item, err := c.h.itemRepo.GetByID(ctx, strconv.FormatInt(req.GetId(), 10), query)
+	if err != nil {
+		return nil, itemStatusError(err)
+	}
+	c.h.setImageURLs(ctx, item)
+	return &catalogv1.GetItemResponse{Item: toProtoItem(item)}, nil
+}
+
+// CreateItem adds an item with the same validation as POST /items .
+func (c *catalogServer) CreateItem(ctx context.Context, req *catalogv1.CreateItemRequest) (*catalogv1.CreateItemResponse, error) {
+	addReq := &AddItemRequest{
+		Name:       req.GetName(),
+		CategoryID: int(req.GetCategoryId()),
+		Category:   req.GetCategory(),
+		Images:     req.GetImages(),
+		ImageIDs:   req.GetImageIds(),
+	}
+	if err := addReq.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	item, similar, err := c.h.addItem(ctx, addReq)
+	if err != nil {
+		if errors.Is(err, errImageNotFound) || errors.Is(err, errCategoryNotFound) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		slog.Error("failed to add item: ", "error", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	c.h.setImageURLs(ctx, item)
+	resp := &catalogv1.CreateItemResponse{Item: toProtoItem(item)}
+	for _, si := range similar {
+		resp.SimilarItemIds = append(resp.SimilarItemIds, int64(si.ID))
+	}
+	return resp, nil
+}
+
+// SearchItems returns the items whose name contains the keyword.
+func (c *catalogServer) SearchItems(ctx context.Context, req *catalogv1.SearchItemsRequest) (*catalogv1.SearchItemsResponse, error) {
+	if req.GetKeyword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "keyword is required")
+	}
+	query, err := c.itemQuery(ctx, req.GetQuery())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.h.itemRepo.Search(ctx, req.GetKeyword(), query)
+	if err != nil {
+		return nil, itemStatusError(err)
+	}
+
+	c.h.setImageURLs(ctx, resp.Items...)
+	items := make([]*catalogv1.Item, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		items = append(items, toProtoItem(item))
+	}
+	return &catalogv1.SearchItemsResponse{Items: items}, nil
+}
+
+// itemStatusError maps errors from ItemRepository to gRPC status errors.
+func itemStatusError(err error) error {
+	switch {
+	case errors.Is(err, errItemNotFound), errors.Is(err, errCategoryNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		slog.Error("failed to get items: ", "error", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// toProtoItem converts an item whose image URLs are filled.
+func toProtoItem(item *Item) *catalogv1.Item {
+	pb := &catalogv1.Item{
+		Id:         int64(item.ID),
+		Name:       item.Name,
+		CategoryId: int64(item.CategoryID),
+		Category:   item.Category,
+		CreatedAt:  protoTime(item.CreatedAt),
+		UpdatedAt:  protoTime(item.UpdatedAt),
+	}
+	if item.DeletedAt != nil {
+		pb.DeletedAt = timestamppb.New(*item.DeletedAt)
+	}
+	for _, image := range item.Images {
+		pb.Images = append(pb.Images, &catalogv1.ItemImage{
+			Id:       int64(image.ID),
+			Name:     image.Name,
+			Url:      image.URL,
+			Position: int32(image.Position),
+		})
+	}
+	return pb
+}
+
+// protoTime converts a timestamp which is left unset when it is zero.
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
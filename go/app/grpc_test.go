@@ -0,0 +1,208 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	catalogv1 "mercari-build-training/gen/catalog/v1"
+)
+
+// newCatalogClient serves the gRPC server of h in memory and returns its client.
+func newCatalogClient(t *testing.T, h *Handlers) catalogv1.CatalogServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(h)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return catalogv1.NewCatalogServiceClient(conn)
+}
+
+// listItemNames collects the names of the items streamed by ListItems.
+func listItemNames(ctx context.Context, client catalogv1.CatalogServiceClient, req *catalogv1.ListItemsRequest) ([]string, error) {
+	stream, err := client.ListItems(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, resp.GetItem().GetName())
+	}
+}
+
+func TestCatalogService(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	h := &Handlers{imgDirPath: t.TempDir(), publicBaseURL: "https://api.example.com", adminToken: "secret", itemRepo: itemRepo, categoryRepo: categoryRepo}
+	client := newCatalogClient(t, h)
+
+	fashion := &Category{Name: "fashion"}
+	if err := categoryRepo.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+	phone := &Category{Name: "phone"}
+	if err := categoryRepo.Create(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for _, req := range []*catalogv1.CreateItemRequest{
+		{Name: "jacket", CategoryId: int64(fashion.ID), Images: [][]byte{[]byte("jacket.jpg")}},
+		{Name: "denim jacket", Category: "fashion", Images: [][]byte{[]byte("denim.jpg"), []byte("tag.jpg")}},
+		{Name: "used phone", CategoryId: int64(phone.ID), Images: [][]byte{[]byte("phone.jpg")}},
+	} {
+		resp, err := client.CreateItem(ctx, req)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", req.GetName(), err)
+		}
+		ids = append(ids, resp.GetItem().GetId())
+	}
+	if err := itemRepo.Delete(ctx, int(ids[2])); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("CreateItem", func(t *testing.T) {
+		t.Parallel()
+
+		cases := map[string]*catalogv1.CreateItemRequest{
+			"ng: no image":         {Name: "hat", CategoryId: int64(fashion.ID)},
+			"ng: unknown category": {Name: "hat", Category: "books", Images: [][]byte{[]byte("hat.jpg")}},
+			"ng: unknown image ID": {Name: "hat", CategoryId: int64(fashion.ID), ImageIds: []string{"missing.jpg"}},
+		}
+		for name, req := range cases {
+			_, err := client.CreateItem(ctx, req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("%s: expected InvalidArgument, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("GetItem", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := client.GetItem(ctx, &catalogv1.GetItemRequest{Id: ids[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := resp.GetItem()
+		if item.GetName() != "denim jacket" || item.GetCategory() != "fashion" || item.GetCreatedAt() == nil {
+			t.Errorf("unexpected item: %v", item)
+		}
+		var urls []string
+		for _, image := range item.GetImages() {
+			urls = append(urls, image.GetUrl())
+		}
+		want := []string{"https://api.example.com/v1/images/" + item.GetImages()[0].GetName(), "https://api.example.com/v1/images/" + item.GetImages()[1].GetName()}
+		if diff := cmp.Diff(want, urls); diff != "" {
+			t.Errorf("unexpected image URLs (-want +got):\n%s", diff)
+		}
+
+		_, err = client.GetItem(ctx, &catalogv1.GetItemRequest{Id: ids[2]})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("expected NotFound for the deleted item, got %v", err)
+		}
+	})
+
+	t.Run("ListItems", func(t *testing.T) {
+		t.Parallel()
+
+		admin := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+		cases := map[string]struct {
+			ctx  context.Context
+			req  *catalogv1.ListItemsRequest
+			want []string
+			code codes.Code
+		}{
+			"ok: all": {
+				ctx:  ctx,
+				req:  &catalogv1.ListItemsRequest{},
+				want: []string{"jacket", "denim jacket"},
+			},
+			"ok: newest in category": {
+				ctx: ctx,
+				req: &catalogv1.ListItemsRequest{
+					CategoryId: int64(fashion.ID),
+					Query:      &catalogv1.ItemQuery{Order: catalogv1.ItemOrder_ITEM_ORDER_NEWEST},
+				},
+				want: []string{"denim jacket", "jacket"},
+			},
+			"ok: deleted items for admins": {
+				ctx:  admin,
+				req:  &catalogv1.ListItemsRequest{Query: &catalogv1.ItemQuery{IncludeDeleted: true}},
+				want: []string{"jacket", "denim jacket", "used phone"},
+			},
+			"ng: deleted items for others": {
+				ctx:  ctx,
+				req:  &catalogv1.ListItemsRequest{Query: &catalogv1.ItemQuery{IncludeDeleted: true}},
+				code: codes.PermissionDenied,
+			},
+			"ng: unknown category": {
+				ctx:  ctx,
+				req:  &catalogv1.ListItemsRequest{CategoryId: 100},
+				code: codes.NotFound,
+			},
+		}
+		for name, tt := range cases {
+			got, err := listItemNames(tt.ctx, client, tt.req)
+			if status.Code(err) != tt.code {
+				t.Errorf("%s: expected %v, got %v", name, tt.code, err)
+				continue
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("%s: unexpected items (-want +got):\n%s", name, diff)
+			}
+		}
+	})
+
+	t.Run("SearchItems", func(t *testing.T) {
+		t.Parallel()
+
+		resp, err := client.SearchItems(ctx, &catalogv1.SearchItemsRequest{Keyword: "JACKET"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, item := range resp.GetItems() {
+			got = append(got, strconv.FormatInt(item.GetId(), 10)+":"+item.GetName())
+		}
+		want := []string{strconv.FormatInt(ids[0], 10) + ":jacket", strconv.FormatInt(ids[1], 10) + ":denim jacket"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected items (-want +got):\n%s", diff)
+		}
+
+		_, err = client.SearchItems(ctx, &catalogv1.SearchItemsRequest{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument without keyword, got %v", err)
+		}
+	})
+}
@@ -5,19 +5,69 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var errImageNotFound = errors.New("image not found")
 var errItemNotFound = errors.New("item not found")
+var errItemImageNotFound = errors.New("item image not found")
+var errTooManyImages = fmt.Errorf("an item can have at most %d images", maxImagesPerItem)
+var errLastImage = errors.New("an item must have at least one image")
+var errInvalidImageOrder = errors.New("image order must list every image of the item exactly once")
+var errCategoryNotFound = errors.New("category not found")
+var errCategoryExists = errors.New("category with the same name already exists")
+var errCategoryInUse = errors.New("category has items or subcategories")
+var errCategoryCycle = errors.New("category cannot be moved under itself or its descendants")
+var errParentCategoryNotFound = errors.New("parent category not found")
+var errInvalidCategoryName = errors.New("category name must contain a letter or a digit")
+
+// maxImagesPerItem is the maximum number of images attached to a single item.
+const maxImagesPerItem = 10
 
 type Item struct {
-	ID       int    `db:"id" json:"-"`
-	Name     string `db:"name" json:"name"`
-	Category string `db:"category" json:"category"`
-	Image    string `db:"image_name" json:"image"`
+	ID         int    `db:"id" json:"id"`
+	Name       string `db:"name" json:"name"`
+	CategoryID int    `db:"category_id" json:"category_id"`
+	Category   string `db:"category" json:"category"`
+	// Image is the file name of the cover image, which is always the first one of Images.
+	Image string `db:"image_name" json:"image"`
+	// ImageURL is the absolute URL of the cover image, which is filled by handlers.
+	ImageURL string       `db:"-" json:"image_url"`
+	Images   []*ItemImage `db:"-" json:"images"`
+	// PerceptualHash is the perceptual hash of the cover image.
+	// It is nil when the image couldn't be decoded.
+	PerceptualHash *uint64    `db:"phash" json:"-"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// ItemQuery holds the options to get items.
+type ItemQuery struct {
+	// IncludeDeleted includes soft-deleted items, which are excluded by default.
+	IncludeDeleted bool
+	// Newest sorts items by creation time in descending order instead of by ID.
+	Newest bool
+}
+
+// SimilarItem is an item whose cover image looks like another one.
+type SimilarItem struct {
+	*Item
+	// Distance is the Hamming distance between the perceptual hashes of the images.
+	Distance int `json:"distance"`
+}
+
+// ItemImage is one of the ordered images of an item.
+type ItemImage struct {
+	ID       int    `db:"id" json:"id"`
+	Name     string `db:"image_name" json:"name"`
+	URL      string `db:"-" json:"url"`
+	Position int    `db:"position" json:"position"`
+	Cover    bool   `db:"-" json:"cover"`
 }
 
 // Please run `go generate ./...` to generate the mock implementation
@@ -26,48 +76,240 @@ type Item struct {
 //go:generate go run go.uber.org/mock/mockgen -source=$GOFILE -package=${GOPACKAGE} -destination=./mock_$GOFILE
 type ItemRepository interface {
 	Insert(ctx context.Context, item *Item) error
-	GetAll(ctx context.Context) (*ItemsWrapper, error)
-	GetByID(ctx context.Context, id string) (*Item, error)
+	GetAll(ctx context.Context, query ItemQuery) (*ItemsWrapper, error)
+	GetByID(ctx context.Context, id string, query ItemQuery) (*Item, error)
+	// Delete soft-deletes an item. The row is kept with deleted_at set.
+	Delete(ctx context.Context, id int) error
+	AddImages(ctx context.Context, itemID int, imageNames []string) ([]*ItemImage, error)
+	ReorderImages(ctx context.Context, itemID int, imageIDs []int) ([]*ItemImage, error)
+	DeleteImage(ctx context.Context, itemID int, imageID int) ([]*ItemImage, error)
+	ImageNames(ctx context.Context) ([]string, error)
+	FindSimilar(ctx context.Context, hash uint64, threshold int) ([]*SimilarItem, error)
+	// UpdatePerceptualHash replaces the perceptual hash of the item while its cover image is coverName.
+	// The hash is nil when it couldn't be computed.
+	UpdatePerceptualHash(ctx context.Context, itemID int, coverName string, hash *uint64) error
+	// GetByCategory returns the items in the category and all of its descendants.
+	GetByCategory(ctx context.Context, categoryID int, query ItemQuery) (*ItemsWrapper, error)
+	// GetByCategories returns the items of GetByCategory for each of the categories in one query, keyed by the category IDs.
+	// The categories without items, including the missing ones, are left out.
+	GetByCategories(ctx context.Context, categoryIDs []int, query ItemQuery) (map[int][]*Item, error)
+	// Search returns the items whose name contains the keyword regardless of the case.
+	Search(ctx context.Context, keyword string, query ItemQuery) (*ItemsWrapper, error)
+}
+
+type Category struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	// Slug is the URL-friendly identifier derived from Name, e.g. "smart-phones" for "Smart Phones".
+	Slug string `db:"slug" json:"slug"`
+	// ParentID is the ID of the parent category. It is nil for root categories.
+	ParentID *int `db:"parent_id" json:"parent_id"`
+}
+
+// CategoryRepository is an interface to manage the category tree.
+type CategoryRepository interface {
+	Create(ctx context.Context, category *Category) error
+	GetAll(ctx context.Context) ([]*Category, error)
+	GetByID(ctx context.Context, id int) (*Category, error)
+	// GetByIDs returns the categories of the IDs in one query. The missing ones are left out.
+	GetByIDs(ctx context.Context, ids []int) ([]*Category, error)
+	GetBySlug(ctx context.Context, slug string) (*Category, error)
+	Update(ctx context.Context, category *Category) error
+	Delete(ctx context.Context, id int) error
 }
 
 // itemRepository is an implementation of ItemRepository
 type itemRepository struct {
-	db      *sql.DB
-	dbPath  string
-	sqlPath string
+	// db is used for writes and transactions.
+	db *sql.DB
+	// readDB is the pool of connections for reads outside transactions. db is used when it is nil.
+	readDB  *sql.DB
+	dialect dialect
+	// stmts and readStmts are the statements prepared on db and readDB.
+	// Queries are run without preparing them when they are nil.
+	stmts     *stmtCache
+	readStmts *stmtCache
 }
 
-func (i *itemRepository) createTables(ctx context.Context) error {
-	sql, err := os.ReadFile(i.sqlPath)
+// reader returns the pool of connections for reads.
+func (i *itemRepository) reader() *sql.DB {
+	if i.readDB != nil {
+		return i.readDB
+	}
+	return i.db
+}
+
+// OpenDB opens the SQLite database at dbPath and creates the tables defined in the SQL file at sqlPath.
+// SQLite allows only one writer at a time, so the returned pool has a single connection
+// and concurrent writes wait for it in Go instead of failing with "database is locked".
+func OpenDB(ctx context.Context, dbPath, sqlPath string) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriverName, sqliteDSN(dbPath))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	err = createTables(ctx, db, sqlPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func createTables(ctx context.Context, db *sql.DB, sqlPath string) error {
+	sql, err := os.ReadFile(sqlPath)
 	if err != nil {
 		return fmt.Errorf("failed to read SQL file: %w", err)
 	}
 
-	_, err = i.db.ExecContext(ctx, string(sql))
+	// migrations upgrade the existing tables before they are compared with the latest schema
+	err = migrate(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, string(sql))
 	if err != nil {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 	return nil
 }
 
-// NewItemRepository creates a new itemRepository.
-func NewItemRepository() ItemRepository {
-	db, err := sql.Open("sqlite3", "db/mercari.sqlite3")
+// NewItemRepository creates a new itemRepository on the SQLite database.
+// Its queries aren't prepared beforehand. OpenStorage creates one with prepared statements.
+func NewItemRepository(db *sql.DB) ItemRepository {
+	return &itemRepository{db: db, dialect: dialectSQLite}
+}
+
+// newItemRepository creates an itemRepository with the frequent queries prepared on db and readDB.
+// The statements are closed by Close.
+func newItemRepository(ctx context.Context, db, readDB *sql.DB, d dialect) (*itemRepository, error) {
+	i := &itemRepository{db: db, readDB: readDB, dialect: d}
+
+	// statements used in transactions must be prepared here, as the writer connection is busy with the transaction
+	writeQueries := []string{
+		selectCategoryNameQuery,
+		insertItemQuery,
+		insertItemImageQuery,
+		appendItemImageQuery,
+		i.lockItemQuery(),
+		selectItemImagesQuery,
+		updateImagePositionQuery,
+		deleteItemImageQuery,
+		updateCoverImageQuery,
+		deleteItemQuery,
+	}
+	readQueries := []string{
+		selectItemQuery,
+		selectItemImagesQuery,
+		selectCategoryIDQuery,
+	}
+	for _, query := range []ItemQuery{{}, {Newest: true}, {IncludeDeleted: true}, {IncludeDeleted: true, Newest: true}} {
+		items, images := listItemsQueries(query, allItemsCond)
+		readQueries = append(readQueries, items, images)
+	}
+
+	var err error
+	i.stmts, err = newStmtCache(ctx, db, i.rebindAll(writeQueries)...)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
 	}
+	i.readStmts, err = newStmtCache(ctx, i.reader(), i.rebindAll(readQueries)...)
+	if err != nil {
+		i.stmts.Close()
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+	return i, nil
+}
 
-	repo := &itemRepository{
-		db:      db,
-		dbPath:  "db/mercari.sqlite3",
-		sqlPath: "db/items.sql",
+func (i *itemRepository) rebindAll(queries []string) []string {
+	rebound := make([]string, len(queries))
+	for n, query := range queries {
+		rebound[n] = i.dialect.rebind(query)
 	}
-	err = repo.createTables(context.Background())
+	return rebound
+}
+
+// Close closes the prepared statements. The connection pools are left open.
+func (i *itemRepository) Close() error {
+	var errs []error
+	for _, c := range []*stmtCache{i.stmts, i.readStmts} {
+		if c != nil {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// query runs a query in tx, or in the transaction of ctx when tx is nil.
+// It runs on the reader pool when there is no transaction.
+// The prepared statement of the query is used if there is one.
+func (i *itemRepository) query(ctx context.Context, tx *sql.Tx, query string, args ...any) (*sql.Rows, error) {
+	query = i.dialect.rebind(query)
+	if tx == nil {
+		tx = txFromContext(ctx, i.db)
+	}
+	if tx != nil {
+		if stmt := i.stmts.lookup(query); stmt != nil {
+			return tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+		}
+		return tx.QueryContext(ctx, query, args...)
+	}
+	if i.readStmts == nil {
+		return i.reader().QueryContext(ctx, query, args...)
+	}
+	stmt, err := i.readStmts.prepare(ctx, query)
 	if err != nil {
-		db.Close()
-		panic(err)
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+// queryRow is like query but returns at most one row.
+func (i *itemRepository) queryRow(ctx context.Context, tx *sql.Tx, query string, args ...any) rowScanner {
+	query = i.dialect.rebind(query)
+	if tx == nil {
+		tx = txFromContext(ctx, i.db)
+	}
+	if tx != nil {
+		if stmt := i.stmts.lookup(query); stmt != nil {
+			return tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+		}
+		return tx.QueryRowContext(ctx, query, args...)
+	}
+	if i.readStmts == nil {
+		return i.reader().QueryRowContext(ctx, query, args...)
+	}
+	stmt, err := i.readStmts.prepare(ctx, query)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// exec runs a statement in tx, or in the transaction of ctx when tx is nil.
+// It runs on the writer when there is no transaction.
+// The prepared statement of the query is used if there is one.
+func (i *itemRepository) exec(ctx context.Context, tx *sql.Tx, query string, args ...any) (sql.Result, error) {
+	query = i.dialect.rebind(query)
+	if tx == nil {
+		tx = txFromContext(ctx, i.db)
+	}
+	if tx != nil {
+		if stmt := i.stmts.lookup(query); stmt != nil {
+			return tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+		}
+		return tx.ExecContext(ctx, query, args...)
+	}
+	if i.stmts == nil {
+		return i.db.ExecContext(ctx, query, args...)
 	}
-	return repo
+	stmt, err := i.stmts.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
 }
 
 type ItemsWrapper struct {
@@ -76,44 +318,263 @@ type ItemsWrapper struct {
 
 // Insert inserts an item into the repository.
 func (i *itemRepository) Insert(ctx context.Context, item *Item) error {
-	tx, err := i.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	if len(item.Images) == 0 && item.Image != "" {
+		item.Images = []*ItemImage{{Name: item.Image}}
+	}
+	if len(item.Images) == 0 {
+		return errLastImage
+	}
+	if len(item.Images) > maxImagesPerItem {
+		return errTooManyImages
 	}
-	defer tx.Rollback()
 
-	var categoryID int
-	err = tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE name = ?", item.Category).Scan(&categoryID)
-	if err == sql.ErrNoRows {
-		res, err := tx.ExecContext(ctx, "INSERT INTO categories (name) VALUES (?)", item.Category)
+	now := currentTime()
+	var itemID int
+	var categoryName string
+	err := inTx(ctx, i.db, func(tx *sql.Tx) error {
+		// categories are managed by CategoryRepository, so the category must exist beforehand
+		err := i.queryRow(ctx, tx, selectCategoryNameQuery, item.CategoryID).Scan(&categoryName)
+		if err == sql.ErrNoRows {
+			return errCategoryNotFound
+		}
 		if err != nil {
 			return err
 		}
-		categoryID64, err := res.LastInsertId()
+
+		// RETURNING is used instead of LastInsertId, which not every driver supports
+		err = i.queryRow(ctx, tx, insertItemQuery,
+			item.Name, item.CategoryID, item.Images[0].Name, phashValue(item.PerceptualHash), now, now).Scan(&itemID)
 		if err != nil {
 			return err
 		}
-		categoryID = int(categoryID64)
-	} else if err != nil {
+
+		for pos, img := range item.Images {
+			err := i.queryRow(ctx, tx, insertItemImageQuery, itemID, img.Name, pos).Scan(&img.ID)
+			if err != nil {
+				return err
+			}
+			img.Position = pos
+			img.Cover = pos == 0
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
+	item.ID = itemID
+	item.Category = categoryName
+	item.CreatedAt = now
+	item.UpdatedAt = now
+	item.Image = item.Images[0].Name
+	return nil
+}
+
+// currentTime returns the time stored in created_at, updated_at and deleted_at.
+// It is truncated to microseconds, which is the precision every supported database keeps.
+func currentTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// itemColumns are the columns scanned by scanItem.
+const itemColumns = "items.id, items.name, items.category_id, categories.name, items.image_name, items.phash, items.created_at, items.updated_at, items.deleted_at"
+
+// The queries run frequently, which are prepared by newItemRepository.
+const (
+	selectItemQuery         = "SELECT " + itemColumns + " FROM items INNER JOIN categories ON items.category_id = categories.id WHERE items.id = ?"
+	selectItemImagesQuery   = "SELECT id, image_name, position FROM item_images WHERE item_id = ? ORDER BY position"
+	selectCategoryIDQuery   = "SELECT id FROM categories WHERE id = ?"
+	selectCategoryNameQuery = "SELECT name FROM categories WHERE id = ?"
+	insertItemQuery         = "INSERT INTO items (name, category_id, image_name, phash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING id"
+	insertItemImageQuery    = "INSERT INTO item_images (item_id, image_name, position) VALUES (?, ?, ?) RETURNING id"
+	// appendItemImageQuery doesn't return the ID, as a reused statement must not be left in progress by Exec
+	appendItemImageQuery     = "INSERT INTO item_images (item_id, image_name, position) VALUES (?, ?, ?)"
+	updateImagePositionQuery = "UPDATE item_images SET position = ? WHERE id = ?"
+	deleteItemImageQuery     = "DELETE FROM item_images WHERE id = ?"
+	updateCoverImageQuery    = "UPDATE items SET image_name = ?, updated_at = ? WHERE id = ?"
+	deleteItemQuery          = "UPDATE items SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL"
+)
+
+// allItemsCond is the condition of queryItems matching every item.
+const allItemsCond = "1 = 1"
+
+// lockItemQuery returns the query to lock an item which isn't deleted.
+func (i *itemRepository) lockItemQuery() string {
+	return "SELECT id FROM items WHERE id = ? AND deleted_at IS NULL" + i.dialect.forUpdate()
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanItem(row rowScanner) (*Item, error) {
+	item := &Item{}
+	var phash sql.NullInt64
+	var deletedAt sql.NullTime
+	err := row.Scan(&item.ID, &item.Name, &item.CategoryID, &item.Category, &item.Image, &phash, &item.CreatedAt, &item.UpdatedAt, &deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	item.PerceptualHash = phashFromNull(phash)
+	if deletedAt.Valid {
+		item.DeletedAt = &deletedAt.Time
+	}
+	return item, nil
+}
 
-	stmt, err := tx.Prepare("INSERT INTO items (name, category_id, image_name) VALUES (?, ?, ?)")
+func (i *itemRepository) GetAll(ctx context.Context, query ItemQuery) (*ItemsWrapper, error) {
+	return i.queryItems(ctx, query, allItemsCond)
+}
+
+// GetByCategory returns the items in the category and all of its descendants.
+func (i *itemRepository) GetByCategory(ctx context.Context, categoryID int, query ItemQuery) (*ItemsWrapper, error) {
+	var id int
+	err := i.queryRow(ctx, nil, selectCategoryIDQuery, categoryID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errCategoryNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return i.queryItems(ctx, query, "items.category_id IN ("+categoryDescendantsQuery+")", categoryID)
+}
+
+// categoriesDescendantsQuery returns the query of the categories and all of their descendants with the category each of them descends from,
+// which is joined with the items by GetByCategories.
+func categoriesDescendantsQuery(n int) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+	return `WITH RECURSIVE descendants(root_id, id) AS (
+	SELECT id, id FROM categories WHERE id IN (` + placeholders + `)
+	UNION
+	SELECT descendants.root_id, categories.id FROM categories INNER JOIN descendants ON categories.parent_id = descendants.id
+) `
+}
+
+// rootScanner scans the category ID of categoriesDescendantsQuery before the columns of an item.
+type rootScanner struct {
+	rowScanner
+	rootID *int
+}
+
+func (r rootScanner) Scan(dest ...any) error {
+	return r.rowScanner.Scan(append([]any{r.rootID}, dest...)...)
+}
+
+// GetByCategories returns the items of GetByCategory for each of the categories in one query, keyed by the category IDs.
+// An item in several of the categories, e.g. in a category and its parent, is returned for each of them.
+func (i *itemRepository) GetByCategories(ctx context.Context, categoryIDs []int, query ItemQuery) (map[int][]*Item, error) {
+	result := make(map[int][]*Item)
+	if len(categoryIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]any, len(categoryIDs))
+	for n, id := range categoryIDs {
+		args[n] = id
+	}
+	cond := "items.category_id IN (SELECT id FROM descendants)"
+	if !query.IncludeDeleted {
+		cond += " AND items.deleted_at IS NULL"
+	}
+	order := "items.id"
+	if query.Newest {
+		order = "items.created_at DESC, items.id DESC"
 	}
-	defer stmt.Close()
+	with := categoriesDescendantsQuery(len(categoryIDs))
+	itemsQuery := with + "SELECT descendants.root_id, " + itemColumns + ` FROM items
+	INNER JOIN categories ON items.category_id = categories.id
+	INNER JOIN descendants ON items.category_id = descendants.id
+	WHERE ` + cond + " ORDER BY descendants.root_id, " + order
+	imagesQuery := with + "SELECT id, item_id, image_name, position FROM item_images WHERE item_id IN (SELECT items.id FROM items WHERE " + cond + ") ORDER BY item_id, position"
 
-	_, err = stmt.Exec(item.Name, categoryID, item.Image)
+	// the queries aren't prepared, as the number of the placeholders varies
+	var q queryer = i.reader()
+	if tx := txFromContext(ctx, i.db); tx != nil {
+		q = tx
+	}
+	rows, err := q.QueryContext(ctx, i.dialect.rebind(itemsQuery), args...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*Item
+	var rootIDs []int
+	for rows.Next() {
+		var rootID int
+		item, err := scanItem(rootScanner{rowScanner: rows, rootID: &rootID})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		rootIDs = append(rootIDs, rootID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	imageRows, err := q.QueryContext(ctx, i.dialect.rebind(imagesQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer imageRows.Close()
+	images := make(map[int][]*ItemImage)
+	for imageRows.Next() {
+		var itemID int
+		img := &ItemImage{}
+		if err := imageRows.Scan(&img.ID, &itemID, &img.Name, &img.Position); err != nil {
+			return nil, err
+		}
+		images[itemID] = append(images[itemID], img)
+	}
+	if err := imageRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for n, item := range items {
+		// the images are copied, as an item may be returned for several categories
+		item.Images = cloneImages(images[item.ID])
+		result[rootIDs[n]] = append(result[rootIDs[n]], item)
 	}
+	return result, nil
+}
+
+// searchItemsCond is the condition of queryItems matching the names which contain the pattern of likePattern.
+const searchItemsCond = `LOWER(items.name) LIKE ? ESCAPE '\'`
+
+// likePattern returns the LIKE pattern matching the strings which contain the keyword in lower case.
+func likePattern(keyword string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(keyword))
+	return "%" + escaped + "%"
+}
 
-	return tx.Commit()
+// Search returns the items whose name contains the keyword regardless of the case.
+func (i *itemRepository) Search(ctx context.Context, keyword string, query ItemQuery) (*ItemsWrapper, error) {
+	return i.queryItems(ctx, query, searchItemsCond, likePattern(keyword))
 }
 
-func (i *itemRepository) GetAll(ctx context.Context) (*ItemsWrapper, error) {
-	rows, err := i.db.QueryContext(ctx, "SELECT items.id, items.name, categories.name, items.image_name FROM items INNER JOIN categories ON items.category_id = categories.id")
+// listItemsQueries returns the queries of the items matching the condition and of their images.
+func listItemsQueries(query ItemQuery, cond string) (items, images string) {
+	if !query.IncludeDeleted {
+		cond = "(" + cond + ") AND items.deleted_at IS NULL"
+	}
+	order := "items.id"
+	if query.Newest {
+		order = "items.created_at DESC, items.id DESC"
+	}
+
+	items = "SELECT " + itemColumns + " FROM items INNER JOIN categories ON items.category_id = categories.id WHERE " + cond + " ORDER BY " + order
+	images = "SELECT id, item_id, image_name, position FROM item_images WHERE item_id IN (SELECT items.id FROM items INNER JOIN categories ON items.category_id = categories.id WHERE " + cond + ") ORDER BY item_id, position"
+	return items, images
+}
+
+// queryItems returns the items matching the condition with their images.
+func (i *itemRepository) queryItems(ctx context.Context, query ItemQuery, cond string, args ...any) (*ItemsWrapper, error) {
+	itemsQuery, imagesQuery := listItemsQueries(query, cond)
+
+	rows, err := i.query(ctx, nil, itemsQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -121,34 +582,356 @@ func (i *itemRepository) GetAll(ctx context.Context) (*ItemsWrapper, error) {
 
 	var items []*Item
 	for rows.Next() {
-		item := &Item{}
-		if err := rows.Scan(&item.ID, &item.Name, &item.Category, &item.Image); err != nil {
+		item, err := scanItem(rows)
+		if err != nil {
 			return nil, err
 		}
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	images, err := i.getImages(ctx, imagesQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.Images = images[item.ID]
+	}
 
 	return &ItemsWrapper{Items: items}, nil
 }
 
-func (i *itemRepository) GetByID(ctx context.Context, id string) (*Item, error) {
+func (i *itemRepository) GetByID(ctx context.Context, id string, query ItemQuery) (*Item, error) {
 	itemID, err := strconv.Atoi(id)
 	if err != nil {
 		return nil, err
 	}
 
-	item := &Item{}
-	err = i.db.QueryRowContext(ctx, "SELECT items.id, items.name, categories.name, items.image_name FROM items INNER JOIN categories ON items.category_id = categories.id WHERE items.id = ?", itemID).Scan(
-		&item.ID, &item.Name, &item.Category, &item.Image)
+	item, err := scanItem(i.queryRow(ctx, nil, selectItemQuery, itemID))
 	if err == sql.ErrNoRows {
 		return nil, errItemNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
+	if item.DeletedAt != nil && !query.IncludeDeleted {
+		return nil, errItemNotFound
+	}
+
+	item.Images, err = i.queryImages(ctx, nil, item.ID)
+	if err != nil {
+		return nil, err
+	}
 	return item, nil
 }
 
+// Delete soft-deletes an item. Its images are kept, as a soft-deleted item can still be viewed by admins.
+func (i *itemRepository) Delete(ctx context.Context, id int) error {
+	now := currentTime()
+	res, err := i.exec(ctx, nil, deleteItemQuery, now, now, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errItemNotFound
+	}
+	return nil
+}
+
+// queryImages returns the images of an item ordered by their position.
+// They are read in tx, or from the reader pool when tx is nil.
+func (i *itemRepository) queryImages(ctx context.Context, tx *sql.Tx, itemID int) ([]*ItemImage, error) {
+	rows, err := i.query(ctx, tx, selectItemImagesQuery, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ItemImage{}
+	for rows.Next() {
+		img := &ItemImage{}
+		if err := rows.Scan(&img.ID, &img.Name, &img.Position); err != nil {
+			return nil, err
+		}
+		img.Cover = len(images) == 0
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// getImages returns the images selected by the query built by listItemsQueries keyed by the item ID.
+func (i *itemRepository) getImages(ctx context.Context, query string, args ...any) (map[int][]*ItemImage, error) {
+	rows, err := i.query(ctx, nil, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanImages(rows)
+}
+
+// scanImages reads rows of the id, item_id, image_name and position of images ordered by the item and the position,
+// and returns them keyed by the item ID. It closes rows.
+func scanImages(rows *sql.Rows) (map[int][]*ItemImage, error) {
+	defer rows.Close()
+
+	images := make(map[int][]*ItemImage)
+	for rows.Next() {
+		var itemID int
+		img := &ItemImage{}
+		if err := rows.Scan(&img.ID, &itemID, &img.Name, &img.Position); err != nil {
+			return nil, err
+		}
+		img.Cover = len(images[itemID]) == 0
+		images[itemID] = append(images[itemID], img)
+	}
+	return images, rows.Err()
+}
+
+// AddImages appends images to an existing item and returns all of its images.
+func (i *itemRepository) AddImages(ctx context.Context, itemID int, imageNames []string) ([]*ItemImage, error) {
+	var result []*ItemImage
+	err := inTx(ctx, i.db, func(tx *sql.Tx) error {
+		images, err := i.lockItemImages(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		if len(images)+len(imageNames) > maxImagesPerItem {
+			return errTooManyImages
+		}
+
+		for n, name := range imageNames {
+			_, err := i.exec(ctx, tx, appendItemImageQuery, itemID, name, len(images)+n)
+			if err != nil {
+				return err
+			}
+		}
+		result, err = i.syncCoverImage(ctx, tx, itemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReorderImages rearranges the images of an item in the order of imageIDs.
+// The first image becomes the cover image.
+func (i *itemRepository) ReorderImages(ctx context.Context, itemID int, imageIDs []int) ([]*ItemImage, error) {
+	var result []*ItemImage
+	err := inTx(ctx, i.db, func(tx *sql.Tx) error {
+		images, err := i.lockItemImages(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		if len(imageIDs) != len(images) {
+			return errInvalidImageOrder
+		}
+		current := make(map[int]bool, len(images))
+		for _, img := range images {
+			current[img.ID] = true
+		}
+		for pos, id := range imageIDs {
+			if !current[id] {
+				return errInvalidImageOrder
+			}
+			delete(current, id)
+
+			_, err := i.exec(ctx, tx, updateImagePositionQuery, pos, id)
+			if err != nil {
+				return err
+			}
+		}
+		result, err = i.syncCoverImage(ctx, tx, itemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteImage removes an image from an item. The last image of an item cannot be deleted.
+func (i *itemRepository) DeleteImage(ctx context.Context, itemID int, imageID int) ([]*ItemImage, error) {
+	var result []*ItemImage
+	err := inTx(ctx, i.db, func(tx *sql.Tx) error {
+		images, err := i.lockItemImages(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, img := range images {
+			found = found || img.ID == imageID
+		}
+		if !found {
+			return errItemImageNotFound
+		}
+		if len(images) == 1 {
+			return errLastImage
+		}
+
+		_, err = i.exec(ctx, tx, deleteItemImageQuery, imageID)
+		if err != nil {
+			return err
+		}
+
+		// close the gap left by the deleted image
+		pos := 0
+		for _, img := range images {
+			if img.ID == imageID {
+				continue
+			}
+			_, err := i.exec(ctx, tx, updateImagePositionQuery, pos, img.ID)
+			if err != nil {
+				return err
+			}
+			pos++
+		}
+		result, err = i.syncCoverImage(ctx, tx, itemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ImageNames returns the names of all images referenced by any item, including soft-deleted ones.
+func (i *itemRepository) ImageNames(ctx context.Context) ([]string, error) {
+	rows, err := i.query(ctx, nil, "SELECT image_name FROM items UNION SELECT image_name FROM item_images")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// FindSimilar returns the items whose perceptual hash is within threshold of hash, nearest first.
+// Items without a hash, e.g. those created before the phash column was added, are never returned.
+// Not every database has a function to count bits, so the distance is computed here.
+func (i *itemRepository) FindSimilar(ctx context.Context, hash uint64, threshold int) ([]*SimilarItem, error) {
+	rows, err := i.query(ctx, nil, "SELECT "+itemColumns+" FROM items INNER JOIN categories ON items.category_id = categories.id WHERE items.phash IS NOT NULL AND items.deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarItem{}
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		if d := hammingDistance(hash, *item.PerceptualHash); d <= threshold {
+			similar = append(similar, &SimilarItem{Item: item, Distance: d})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(similar) > 0 {
+		itemIDs := make([]any, len(similar))
+		for j, s := range similar {
+			itemIDs[j] = s.ID
+		}
+		// the images of every match are read in one query, which isn't prepared as the number of the placeholders varies
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(itemIDs)), ", ")
+		var q queryer = i.reader()
+		if tx := txFromContext(ctx, i.db); tx != nil {
+			q = tx
+		}
+		rows, err := q.QueryContext(ctx, i.dialect.rebind("SELECT id, item_id, image_name, position FROM item_images WHERE item_id IN ("+placeholders+") ORDER BY item_id, position"), itemIDs...)
+		if err != nil {
+			return nil, err
+		}
+		images, err := scanImages(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range similar {
+			s.Images = images[s.ID]
+		}
+	}
+	sortSimilarItems(similar)
+	return similar, nil
+}
+
+// UpdatePerceptualHash replaces the perceptual hash of the item while its cover image is coverName.
+// Nothing is updated when the cover has been replaced in the meantime.
+func (i *itemRepository) UpdatePerceptualHash(ctx context.Context, itemID int, coverName string, hash *uint64) error {
+	_, err := i.exec(ctx, nil, "UPDATE items SET phash = ? WHERE id = ? AND image_name = ?", phashValue(hash), itemID, coverName)
+	return err
+}
+
+// sortSimilarItems sorts items by distance, then by ID.
+func sortSimilarItems(items []*SimilarItem) {
+	slices.SortFunc(items, func(a, b *SimilarItem) int {
+		if a.Distance != b.Distance {
+			return a.Distance - b.Distance
+		}
+		return a.ID - b.ID
+	})
+}
+
+// phashValue converts a perceptual hash to a value stored in an INTEGER column.
+// The bits are kept as is, so the stored value may be negative.
+func phashValue(hash *uint64) any {
+	if hash == nil {
+		return nil
+	}
+	return int64(*hash)
+}
+
+func phashFromNull(v sql.NullInt64) *uint64 {
+	if !v.Valid {
+		return nil
+	}
+	hash := uint64(v.Int64)
+	return &hash
+}
+
+// lockItemImages checks that the item exists and returns its images inside tx.
+// The item is locked so that concurrent changes of its images are applied one by one.
+func (i *itemRepository) lockItemImages(ctx context.Context, tx *sql.Tx, itemID int) ([]*ItemImage, error) {
+	var id int
+	err := i.queryRow(ctx, tx, i.lockItemQuery(), itemID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return i.queryImages(ctx, tx, itemID)
+}
+
+// syncCoverImage sets the first image of the item as its cover image in tx and returns the images.
+func (i *itemRepository) syncCoverImage(ctx context.Context, tx *sql.Tx, itemID int) ([]*ItemImage, error) {
+	images, err := i.queryImages(ctx, tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = i.exec(ctx, tx, updateCoverImageQuery, images[0].Name, currentTime(), itemID)
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
 // StoreImage stores an image and returns an error if any.
 // This package doesn't have a related interface for simplicity.
 func StoreImage(fileName string, image []byte) error {
@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// categoryDescendantsQuery selects the IDs of a category given as the parameter and all of its descendants.
+const categoryDescendantsQuery = `WITH RECURSIVE descendants(id) AS (
+	SELECT id FROM categories WHERE id = ?
+	UNION
+	SELECT categories.id FROM categories INNER JOIN descendants ON categories.parent_id = descendants.id
+) SELECT id FROM descendants`
+
+// categoryRepository is an implementation of CategoryRepository
+type categoryRepository struct {
+	// db is used for writes and transactions.
+	db *sql.DB
+	// readDB is the pool of connections for reads outside transactions. db is used when it is nil.
+	readDB  *sql.DB
+	dialect dialect
+}
+
+// reader returns the transaction of ctx, or the pool of connections for reads when there is none.
+func (c *categoryRepository) reader(ctx context.Context) queryer {
+	if tx := txFromContext(ctx, c.db); tx != nil {
+		return tx
+	}
+	if c.readDB != nil {
+		return c.readDB
+	}
+	return c.db
+}
+
+// NewCategoryRepository creates a new categoryRepository on the SQLite database.
+func NewCategoryRepository(db *sql.DB) CategoryRepository {
+	return &categoryRepository{db: db, dialect: dialectSQLite}
+}
+
+// slugify converts a category name into a slug, e.g. "Smart Phones" into "smart-phones".
+// Letters and digits of any language are kept so that non-English names have a slug as well.
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// Create inserts a category. The name must be unique case-insensitively and the parent must exist.
+func (c *categoryRepository) Create(ctx context.Context, category *Category) error {
+	category.Slug = slugify(category.Name)
+	if category.Slug == "" {
+		return errInvalidCategoryName
+	}
+
+	var id int
+	err := inTx(ctx, c.db, func(tx *sql.Tx) error {
+		if category.ParentID != nil {
+			_, err := c.getCategory(ctx, tx, *category.ParentID)
+			if errors.Is(err, errCategoryNotFound) {
+				return errParentCategoryNotFound
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// the unique constraints of the name and the slug detect duplicates even if two requests race
+		err := tx.QueryRowContext(ctx, c.dialect.rebind("INSERT INTO categories (name, slug, parent_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING RETURNING id"),
+			category.Name, category.Slug, category.ParentID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return errCategoryExists
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	category.ID = id
+	return nil
+}
+
+func (c *categoryRepository) GetAll(ctx context.Context) ([]*Category, error) {
+	rows, err := c.reader(ctx).QueryContext(ctx, "SELECT id, name, slug, parent_id FROM categories ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+	for rows.Next() {
+		category := &Category{}
+		if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.ParentID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (c *categoryRepository) GetByID(ctx context.Context, id int) (*Category, error) {
+	return c.getCategory(ctx, c.reader(ctx), id)
+}
+
+func (c *categoryRepository) GetByIDs(ctx context.Context, ids []int) ([]*Category, error) {
+	categories := []*Category{}
+	if len(ids) == 0 {
+		return categories, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	rows, err := c.reader(ctx).QueryContext(ctx, c.dialect.rebind("SELECT id, name, slug, parent_id FROM categories WHERE id IN ("+placeholders+") ORDER BY id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		category := &Category{}
+		if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.ParentID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (c *categoryRepository) GetBySlug(ctx context.Context, slug string) (*Category, error) {
+	category := &Category{}
+	err := c.reader(ctx).QueryRowContext(ctx, c.dialect.rebind("SELECT id, name, slug, parent_id FROM categories WHERE slug = ?"), slug).Scan(
+		&category.ID, &category.Name, &category.Slug, &category.ParentID)
+	if err == sql.ErrNoRows {
+		return nil, errCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// Update renames or moves a category. A category cannot be moved under itself or its descendants.
+func (c *categoryRepository) Update(ctx context.Context, category *Category) error {
+	category.Slug = slugify(category.Name)
+	if category.Slug == "" {
+		return errInvalidCategoryName
+	}
+
+	return inTx(ctx, c.db, func(tx *sql.Tx) error {
+		_, err := c.getCategory(ctx, tx, category.ID)
+		if err != nil {
+			return err
+		}
+		err = c.checkCategoryName(ctx, tx, category, category.ID)
+		if err != nil {
+			return err
+		}
+		if category.ParentID != nil {
+			_, err := c.getCategory(ctx, tx, *category.ParentID)
+			if errors.Is(err, errCategoryNotFound) {
+				return errParentCategoryNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			var n int
+			err = tx.QueryRowContext(ctx, c.dialect.rebind("SELECT COUNT(*) FROM ("+categoryDescendantsQuery+") AS descendants WHERE id = ?"), category.ID, *category.ParentID).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				return errCategoryCycle
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, c.dialect.rebind("UPDATE categories SET name = ?, slug = ?, parent_id = ? WHERE id = ?"), category.Name, category.Slug, category.ParentID, category.ID)
+		// another request may have taken the name after checkCategoryName, which only the unique constraints detect
+		if c.dialect.isUniqueViolation(err) {
+			return errCategoryExists
+		}
+		return err
+	})
+}
+
+// Delete deletes a category which has neither items nor subcategories.
+func (c *categoryRepository) Delete(ctx context.Context, id int) error {
+	return inTx(ctx, c.db, func(tx *sql.Tx) error {
+		_, err := c.getCategory(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		var n int
+		err = tx.QueryRowContext(ctx, c.dialect.rebind("SELECT (SELECT COUNT(*) FROM items WHERE category_id = ?) + (SELECT COUNT(*) FROM categories WHERE parent_id = ?)"), id, id).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errCategoryInUse
+		}
+
+		_, err = tx.ExecContext(ctx, c.dialect.rebind("DELETE FROM categories WHERE id = ?"), id)
+		return err
+	})
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (c *categoryRepository) getCategory(ctx context.Context, q queryer, id int) (*Category, error) {
+	category := &Category{}
+	err := q.QueryRowContext(ctx, c.dialect.rebind("SELECT id, name, slug, parent_id FROM categories WHERE id = ?"), id).Scan(
+		&category.ID, &category.Name, &category.Slug, &category.ParentID)
+	if err == sql.ErrNoRows {
+		return nil, errCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// checkCategoryName checks that no other category than exceptID has the same name or slug.
+func (c *categoryRepository) checkCategoryName(ctx context.Context, tx *sql.Tx, category *Category, exceptID int) error {
+	var n int
+	err := tx.QueryRowContext(ctx, c.dialect.rebind("SELECT COUNT(*) FROM categories WHERE (LOWER(name) = LOWER(?) OR slug = ?) AND id <> ?"), category.Name, category.Slug, exceptID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errCategoryExists
+	}
+	return nil
+}
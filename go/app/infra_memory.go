@@ -0,0 +1,642 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore holds items and categories in memory instead of a database.
+// It is shared by memoryItemRepository and memoryCategoryRepository, as items refer to categories.
+// Everything is lost when the process exits, so it is meant for tests and demos.
+type memoryStore struct {
+	mu         sync.RWMutex
+	items      []*Item
+	categories []*Category
+	// lastIDs are the last auto-incremented IDs of items, images and categories like AUTOINCREMENT of SQLite.
+	lastItemID, lastImageID, lastCategoryID int
+}
+
+// memoryItemRepository is an implementation of ItemRepository in memory.
+type memoryItemRepository struct {
+	*memoryStore
+}
+
+// memoryCategoryRepository is an implementation of CategoryRepository in memory.
+type memoryCategoryRepository struct {
+	*memoryStore
+}
+
+// NewMemoryRepositories creates an empty pair of repositories in memory.
+// They behave the same as the ones on databases, and are safe for concurrent use.
+func NewMemoryRepositories() (ItemRepository, CategoryRepository) {
+	store := &memoryStore{}
+	return &memoryItemRepository{store}, &memoryCategoryRepository{store}
+}
+
+// cloneItem copies an item so that callers can't modify the stored one.
+func cloneItem(item *Item) *Item {
+	c := *item
+	c.Images = cloneImages(item.Images)
+	if item.PerceptualHash != nil {
+		hash := *item.PerceptualHash
+		c.PerceptualHash = &hash
+	}
+	if item.DeletedAt != nil {
+		deletedAt := *item.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return &c
+}
+
+func cloneImages(images []*ItemImage) []*ItemImage {
+	c := make([]*ItemImage, len(images))
+	for n, img := range images {
+		clone := *img
+		clone.Cover = n == 0
+		c[n] = &clone
+	}
+	return c
+}
+
+func cloneCategory(category *Category) *Category {
+	c := *category
+	if category.ParentID != nil {
+		parentID := *category.ParentID
+		c.ParentID = &parentID
+	}
+	return &c
+}
+
+// category returns the stored category. The caller must hold the lock.
+func (m *memoryStore) category(id int) *Category {
+	for _, category := range m.categories {
+		if category.ID == id {
+			return category
+		}
+	}
+	return nil
+}
+
+// item returns the stored item which is not deleted. The caller must hold the lock.
+func (m *memoryStore) item(id int) *Item {
+	for _, item := range m.items {
+		if item.ID == id && item.DeletedAt == nil {
+			return item
+		}
+	}
+	return nil
+}
+
+// descendants returns the IDs of the category and all of its descendants. The caller must hold the lock.
+func (m *memoryStore) descendants(id int) map[int]bool {
+	ids := map[int]bool{id: true}
+	for found := true; found; {
+		found = false
+		for _, category := range m.categories {
+			if category.ParentID != nil && ids[*category.ParentID] && !ids[category.ID] {
+				ids[category.ID] = true
+				found = true
+			}
+		}
+	}
+	return ids
+}
+
+func (m *memoryItemRepository) Insert(ctx context.Context, item *Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	category := m.category(item.CategoryID)
+	if category == nil {
+		return errCategoryNotFound
+	}
+	if len(item.Images) == 0 && item.Image != "" {
+		item.Images = []*ItemImage{{Name: item.Image}}
+	}
+	if len(item.Images) == 0 {
+		return errLastImage
+	}
+	if len(item.Images) > maxImagesPerItem {
+		return errTooManyImages
+	}
+
+	m.lastItemID++
+	item.ID = m.lastItemID
+	for pos, img := range item.Images {
+		m.lastImageID++
+		img.ID = m.lastImageID
+		img.Position = pos
+		img.Cover = pos == 0
+	}
+	item.Category = category.Name
+	item.CreatedAt = currentTime()
+	item.UpdatedAt = item.CreatedAt
+	item.Image = item.Images[0].Name
+
+	m.items = append(m.items, cloneItem(item))
+	return nil
+}
+
+func (m *memoryItemRepository) GetAll(ctx context.Context, query ItemQuery) (*ItemsWrapper, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.queryItems(query, func(*Item) bool { return true }), nil
+}
+
+// GetByCategory returns the items in the category and all of its descendants.
+func (m *memoryItemRepository) GetByCategory(ctx context.Context, categoryID int, query ItemQuery) (*ItemsWrapper, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.category(categoryID) == nil {
+		return nil, errCategoryNotFound
+	}
+	ids := m.descendants(categoryID)
+	return m.queryItems(query, func(item *Item) bool { return ids[item.CategoryID] }), nil
+}
+
+// GetByCategories returns the items of GetByCategory for each of the categories, keyed by the category IDs.
+func (m *memoryItemRepository) GetByCategories(ctx context.Context, categoryIDs []int, query ItemQuery) (map[int][]*Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[int][]*Item)
+	for _, categoryID := range categoryIDs {
+		if m.category(categoryID) == nil {
+			continue
+		}
+		ids := m.descendants(categoryID)
+		if items := m.queryItems(query, func(item *Item) bool { return ids[item.CategoryID] }).Items; len(items) > 0 {
+			result[categoryID] = items
+		}
+	}
+	return result, nil
+}
+
+// Search returns the items whose name contains the keyword regardless of the case.
+func (m *memoryItemRepository) Search(ctx context.Context, keyword string, query ItemQuery) (*ItemsWrapper, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keyword = strings.ToLower(keyword)
+	return m.queryItems(query, func(item *Item) bool { return strings.Contains(strings.ToLower(item.Name), keyword) }), nil
+}
+
+// queryItems returns the copies of the items matching the condition in the order of the query. The caller must hold the lock.
+func (m *memoryItemRepository) queryItems(query ItemQuery, cond func(*Item) bool) *ItemsWrapper {
+	var items []*Item
+	for _, item := range m.items {
+		if (item.DeletedAt == nil || query.IncludeDeleted) && cond(item) {
+			items = append(items, cloneItem(item))
+		}
+	}
+	if query.Newest {
+		slices.SortStableFunc(items, func(a, b *Item) int {
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+			return b.ID - a.ID
+		})
+	}
+	return &ItemsWrapper{Items: items}
+}
+
+func (m *memoryItemRepository) GetByID(ctx context.Context, id string, query ItemQuery) (*Item, error) {
+	itemID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, item := range m.items {
+		if item.ID == itemID && (item.DeletedAt == nil || query.IncludeDeleted) {
+			return cloneItem(item), nil
+		}
+	}
+	return nil, errItemNotFound
+}
+
+// Delete soft-deletes an item. Its images are kept, as a soft-deleted item can still be viewed by admins.
+func (m *memoryItemRepository) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.item(id)
+	if item == nil {
+		return errItemNotFound
+	}
+	now := currentTime()
+	item.DeletedAt = &now
+	item.UpdatedAt = now
+	return nil
+}
+
+// AddImages appends images to an existing item and returns all of its images.
+func (m *memoryItemRepository) AddImages(ctx context.Context, itemID int, imageNames []string) ([]*ItemImage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.item(itemID)
+	if item == nil {
+		return nil, errItemNotFound
+	}
+	if len(item.Images)+len(imageNames) > maxImagesPerItem {
+		return nil, errTooManyImages
+	}
+
+	for _, name := range imageNames {
+		m.lastImageID++
+		item.Images = append(item.Images, &ItemImage{ID: m.lastImageID, Name: name})
+	}
+	return m.commitImages(item, item.Images), nil
+}
+
+// ReorderImages rearranges the images of an item in the order of imageIDs.
+// The first image becomes the cover image.
+func (m *memoryItemRepository) ReorderImages(ctx context.Context, itemID int, imageIDs []int) ([]*ItemImage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.item(itemID)
+	if item == nil {
+		return nil, errItemNotFound
+	}
+	if len(imageIDs) != len(item.Images) {
+		return nil, errInvalidImageOrder
+	}
+	images := make([]*ItemImage, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		n := slices.IndexFunc(item.Images, func(img *ItemImage) bool { return img.ID == id })
+		if n < 0 || slices.Contains(images, item.Images[n]) {
+			return nil, errInvalidImageOrder
+		}
+		images = append(images, item.Images[n])
+	}
+	return m.commitImages(item, images), nil
+}
+
+// DeleteImage removes an image from an item. The last image of an item cannot be deleted.
+func (m *memoryItemRepository) DeleteImage(ctx context.Context, itemID int, imageID int) ([]*ItemImage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.item(itemID)
+	if item == nil {
+		return nil, errItemNotFound
+	}
+	n := slices.IndexFunc(item.Images, func(img *ItemImage) bool { return img.ID == imageID })
+	if n < 0 {
+		return nil, errItemImageNotFound
+	}
+	if len(item.Images) == 1 {
+		return nil, errLastImage
+	}
+	return m.commitImages(item, slices.Delete(slices.Clone(item.Images), n, n+1)), nil
+}
+
+// UpdatePerceptualHash replaces the perceptual hash of the item while its cover image is coverName.
+// Nothing is updated when the cover has been replaced in the meantime.
+func (m *memoryItemRepository) UpdatePerceptualHash(ctx context.Context, itemID int, coverName string, hash *uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := m.item(itemID)
+	if item == nil || item.Image != coverName {
+		return nil
+	}
+	item.PerceptualHash = nil
+	if hash != nil {
+		h := *hash
+		item.PerceptualHash = &h
+	}
+	return nil
+}
+
+// commitImages stores the images of the item in order and syncs the cover image. The caller must hold the lock.
+func (m *memoryItemRepository) commitImages(item *Item, images []*ItemImage) []*ItemImage {
+	for pos, img := range images {
+		img.Position = pos
+	}
+	item.Images = images
+	item.Image = images[0].Name
+	item.UpdatedAt = currentTime()
+	return cloneImages(images)
+}
+
+// ImageNames returns the names of all images referenced by any item, including soft-deleted ones.
+func (m *memoryItemRepository) ImageNames(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for _, item := range m.items {
+		names = append(names, item.Image)
+		for _, img := range item.Images {
+			names = append(names, img.Name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// FindSimilar returns the items whose perceptual hash is within threshold of hash, nearest first.
+func (m *memoryItemRepository) FindSimilar(ctx context.Context, hash uint64, threshold int) ([]*SimilarItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	similar := []*SimilarItem{}
+	for _, item := range m.items {
+		if item.DeletedAt != nil || item.PerceptualHash == nil {
+			continue
+		}
+		if d := hammingDistance(hash, *item.PerceptualHash); d <= threshold {
+			similar = append(similar, &SimilarItem{Item: cloneItem(item), Distance: d})
+		}
+	}
+	sortSimilarItems(similar)
+	return similar, nil
+}
+
+// Create inserts a category. The name must be unique case-insensitively and the parent must exist.
+func (m *memoryCategoryRepository) Create(ctx context.Context, category *Category) error {
+	category.Slug = slugify(category.Name)
+	if category.Slug == "" {
+		return errInvalidCategoryName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if category.ParentID != nil && m.category(*category.ParentID) == nil {
+		return errParentCategoryNotFound
+	}
+	if err := m.checkCategoryName(category, 0); err != nil {
+		return err
+	}
+
+	m.lastCategoryID++
+	category.ID = m.lastCategoryID
+	m.categories = append(m.categories, cloneCategory(category))
+	return nil
+}
+
+func (m *memoryCategoryRepository) GetAll(ctx context.Context) ([]*Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	categories := []*Category{}
+	for _, category := range m.categories {
+		categories = append(categories, cloneCategory(category))
+	}
+	return categories, nil
+}
+
+func (m *memoryCategoryRepository) GetByID(ctx context.Context, id int) (*Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	category := m.category(id)
+	if category == nil {
+		return nil, errCategoryNotFound
+	}
+	return cloneCategory(category), nil
+}
+
+func (m *memoryCategoryRepository) GetByIDs(ctx context.Context, ids []int) ([]*Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	categories := []*Category{}
+	for _, category := range m.categories {
+		if wanted[category.ID] {
+			categories = append(categories, cloneCategory(category))
+		}
+	}
+	return categories, nil
+}
+
+func (m *memoryCategoryRepository) GetBySlug(ctx context.Context, slug string) (*Category, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, category := range m.categories {
+		if category.Slug == slug {
+			return cloneCategory(category), nil
+		}
+	}
+	return nil, errCategoryNotFound
+}
+
+// Update renames or moves a category. A category cannot be moved under itself or its descendants.
+func (m *memoryCategoryRepository) Update(ctx context.Context, category *Category) error {
+	category.Slug = slugify(category.Name)
+	if category.Slug == "" {
+		return errInvalidCategoryName
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.category(category.ID)
+	if stored == nil {
+		return errCategoryNotFound
+	}
+	if err := m.checkCategoryName(category, category.ID); err != nil {
+		return err
+	}
+	if category.ParentID != nil {
+		if m.category(*category.ParentID) == nil {
+			return errParentCategoryNotFound
+		}
+		if m.descendants(category.ID)[*category.ParentID] {
+			return errCategoryCycle
+		}
+	}
+
+	*stored = *cloneCategory(category)
+	// items show the name of their category
+	for _, item := range m.items {
+		if item.CategoryID == category.ID {
+			item.Category = category.Name
+		}
+	}
+	return nil
+}
+
+// Delete deletes a category which has neither items nor subcategories.
+func (m *memoryCategoryRepository) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.category(id) == nil {
+		return errCategoryNotFound
+	}
+	for _, item := range m.items {
+		if item.CategoryID == id {
+			return errCategoryInUse
+		}
+	}
+	for _, category := range m.categories {
+		if category.ParentID != nil && *category.ParentID == id {
+			return errCategoryInUse
+		}
+	}
+
+	m.categories = slices.DeleteFunc(m.categories, func(category *Category) bool { return category.ID == id })
+	return nil
+}
+
+// checkCategoryName checks that no other category than exceptID has the same name or slug. The caller must hold the lock.
+func (m *memoryCategoryRepository) checkCategoryName(category *Category, exceptID int) error {
+	for _, c := range m.categories {
+		if c.ID != exceptID && (strings.EqualFold(c.Name, category.Name) || c.Slug == category.Slug) {
+			return errCategoryExists
+		}
+	}
+	return nil
+}
+
+// memoryWebhookRepository is an implementation of WebhookRepository in memory.
+type memoryWebhookRepository struct {
+	mu         sync.Mutex
+	webhooks   []*Webhook
+	deliveries []*WebhookDelivery
+	// lastIDs are the last auto-incremented IDs of webhooks and deliveries.
+	lastWebhookID, lastDeliveryID int
+}
+
+// NewMemoryWebhookRepository creates an empty WebhookRepository in memory, which is safe for concurrent use.
+func NewMemoryWebhookRepository() WebhookRepository {
+	return &memoryWebhookRepository{}
+}
+
+func (m *memoryWebhookRepository) Create(ctx context.Context, webhook *Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastWebhookID++
+	webhook.ID = m.lastWebhookID
+	webhook.CreatedAt = currentTime()
+	c := *webhook
+	c.EventTypes = slices.Clone(webhook.EventTypes)
+	m.webhooks = append(m.webhooks, &c)
+	return nil
+}
+
+func (m *memoryWebhookRepository) Enqueue(ctx context.Context, eventID, eventType string, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := currentTime()
+	for _, webhook := range m.webhooks {
+		if !slices.Contains(webhook.EventTypes, eventType) {
+			continue
+		}
+		m.lastDeliveryID++
+		m.deliveries = append(m.deliveries, &WebhookDelivery{
+			ID:            m.lastDeliveryID,
+			WebhookID:     webhook.ID,
+			URL:           webhook.URL,
+			Secret:        webhook.Secret,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       slices.Clone(payload),
+			Status:        deliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return nil
+}
+
+func (m *memoryWebhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == deliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b *WebhookDelivery) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+
+	claimed := []*WebhookDelivery{}
+	token := rand.Text()
+	for _, d := range due[:min(limit, len(due))] {
+		d.ClaimToken = token
+		claimed = append(claimed, cloneDelivery(d))
+		d.NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (m *memoryWebhookRepository) MarkDelivered(ctx context.Context, id int, claimToken string) error {
+	return m.update(id, claimToken, func(d *WebhookDelivery) {
+		d.Status = deliveryDelivered
+		d.LastError = ""
+	})
+}
+
+func (m *memoryWebhookRepository) MarkFailed(ctx context.Context, id int, claimToken, lastError string, next time.Time, dead bool) error {
+	return m.update(id, claimToken, func(d *WebhookDelivery) {
+		if dead {
+			d.Status = deliveryDead
+		}
+		d.LastError = lastError
+		d.NextAttemptAt = next
+	})
+}
+
+// update records an attempt of the delivery changed by fn, which must be pending under claimToken.
+func (m *memoryWebhookRepository) update(id int, claimToken string, fn func(d *WebhookDelivery)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.deliveries {
+		if d.ID == id && d.Status == deliveryPending && d.ClaimToken == claimToken {
+			d.Attempts++
+			fn(d)
+			return nil
+		}
+	}
+	return errDeliveryNotClaimed
+}
+
+func (m *memoryWebhookRepository) Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []*WebhookDelivery{}
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, cloneDelivery(d))
+		}
+	}
+	return deliveries, nil
+}
+
+func cloneDelivery(d *WebhookDelivery) *WebhookDelivery {
+	c := *d
+	c.Payload = slices.Clone(d.Payload)
+	return &c
+}
+
+// memoryTxManager is an implementation of TxManager for the repositories in memory.
+// Each change is applied immediately, so the changes made before fn fails are not rolled back.
+type memoryTxManager struct{}
+
+func (memoryTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
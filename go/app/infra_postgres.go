@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// OpenPostgres opens the PostgreSQL database at the connection URL and creates the tables defined in the SQL file at sqlPath.
+// Unlike SQLite, there are no legacy databases to migrate, so the SQL file must be idempotent by itself.
+func OpenPostgres(ctx context.Context, url, sqlPath string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := os.ReadFile(sqlPath)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read SQL file: %w", err)
+	}
+	_, err = db.ExecContext(ctx, string(schema))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	return db, nil
+}
+
+// NewPostgresItemRepository creates a new itemRepository on the PostgreSQL database.
+// Its queries aren't prepared beforehand. OpenStorage creates one with prepared statements.
+func NewPostgresItemRepository(db *sql.DB) ItemRepository {
+	return &itemRepository{db: db, dialect: dialectPostgres}
+}
+
+// NewPostgresCategoryRepository creates a new categoryRepository on the PostgreSQL database.
+func NewPostgresCategoryRepository(db *sql.DB) CategoryRepository {
+	return &categoryRepository{db: db, dialect: dialectPostgres}
+}
+
+// NewPostgresWebhookRepository creates a new webhookRepository on the PostgreSQL database.
+func NewPostgresWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db, dialect: dialectPostgres}
+}
@@ -0,0 +1,238 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConcurrentInsertE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	ctx := context.Background()
+	itemRepo := &itemRepository{db: db}
+	categoryRepo := &categoryRepository{db: db}
+	phone := createCategory(t, db, "phone", nil)
+
+	const items, categories = 50, 10
+	var wg sync.WaitGroup
+	itemErrs := make(chan error, items)
+	categoryErrs := make(chan error, categories)
+	for n := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			itemErrs <- itemRepo.Insert(ctx, &Item{Name: fmt.Sprintf("item %d", n), CategoryID: phone.ID, Image: "a.jpg"})
+		}()
+	}
+	for n := range categories {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the same name in different case
+			name := "bags"
+			if n%2 == 0 {
+				name = "Bags"
+			}
+			categoryErrs <- categoryRepo.Create(ctx, &Category{Name: name})
+		}()
+	}
+	wg.Wait()
+	close(itemErrs)
+	close(categoryErrs)
+
+	for err := range itemErrs {
+		if err != nil {
+			t.Errorf("failed to insert item: %v", err)
+		}
+	}
+	created := 0
+	for err := range categoryErrs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, errCategoryExists):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("expected exactly one category to be created, got %d", created)
+	}
+
+	var n, distinct int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*), COUNT(DISTINCT id) FROM items WHERE category_id = ?", phone.ID).Scan(&n, &distinct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != items || distinct != items {
+		t.Errorf("expected %d items with distinct IDs, got %d items with %d IDs", items, n, distinct)
+	}
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM categories WHERE name = 'bags' COLLATE NOCASE").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 category named bags, got %d", n)
+	}
+}
+
+func TestSoftDeleteE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	ctx := context.Background()
+	repo := &itemRepository{db: db}
+	phone := createCategory(t, db, "phone", nil)
+
+	var inserted []*Item
+	for _, name := range []string{"a", "b", "c"} {
+		item := &Item{Name: name, CategoryID: phone.ID, Image: name + ".jpg"}
+		if err := repo.Insert(ctx, item); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+		if item.CreatedAt.IsZero() || !item.UpdatedAt.Equal(item.CreatedAt) {
+			t.Errorf("unexpected timestamps: created_at=%v updated_at=%v", item.CreatedAt, item.UpdatedAt)
+		}
+		inserted = append(inserted, item)
+	}
+
+	if err := repo.Delete(ctx, inserted[1].ID); err != nil {
+		t.Fatalf("failed to delete item: %v", err)
+	}
+	if err := repo.Delete(ctx, inserted[1].ID); !errors.Is(err, errItemNotFound) {
+		t.Errorf("expected errItemNotFound for a deleted item, got %v", err)
+	}
+
+	names := func(resp *ItemsWrapper) []string {
+		var got []string
+		for _, item := range resp.Items {
+			got = append(got, item.Name)
+		}
+		return got
+	}
+	cases := map[string]struct {
+		query ItemQuery
+		want  []string
+	}{
+		"deleted items are excluded": {
+			want: []string{"a", "c"},
+		},
+		"deleted items are included": {
+			query: ItemQuery{IncludeDeleted: true},
+			want:  []string{"a", "b", "c"},
+		},
+		"newest first": {
+			query: ItemQuery{Newest: true},
+			want:  []string{"c", "a"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := repo.GetAll(ctx, tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, names(resp)); diff != "" {
+				t.Errorf("unexpected items (-want +got):\n%s", diff)
+			}
+			resp, err = repo.GetByCategory(ctx, phone.ID, tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, names(resp)); diff != "" {
+				t.Errorf("unexpected items in category (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	_, err = repo.GetByID(ctx, strconv.Itoa(inserted[1].ID), ItemQuery{})
+	if !errors.Is(err, errItemNotFound) {
+		t.Errorf("expected errItemNotFound, got %v", err)
+	}
+	got, err := repo.GetByID(ctx, strconv.Itoa(inserted[1].ID), ItemQuery{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("failed to get deleted item: %v", err)
+	}
+	if got.DeletedAt == nil || got.UpdatedAt.Before(*got.DeletedAt) {
+		t.Errorf("unexpected timestamps of deleted item: deleted_at=%v updated_at=%v", got.DeletedAt, got.UpdatedAt)
+	}
+}
+
+// benchmarkRepositories returns the repositories to compare on a temporary SQLite database,
+// one running the queries as is and the other with the prepared statements created by OpenStorage.
+func benchmarkRepositories(b *testing.B) (map[string]ItemRepository, *Category) {
+	b.Helper()
+
+	storage := setupSQLiteStorage(b, StorageConfig{MaxOpenConns: 4})
+	category := &Category{Name: "phone"}
+	if err := storage.Categories.Create(context.Background(), category); err != nil {
+		b.Fatal(err)
+	}
+	return map[string]ItemRepository{
+		"unprepared": &itemRepository{db: storage.pools["writer"], readDB: storage.pools["reader"], dialect: dialectSQLite},
+		"prepared":   storage.Items,
+	}, category
+}
+
+func BenchmarkInsert(b *testing.B) {
+	repos, category := benchmarkRepositories(b)
+	ctx := context.Background()
+
+	for _, name := range []string{"unprepared", "prepared"} {
+		b.Run(name, func(b *testing.B) {
+			for n := 0; b.Loop(); n++ {
+				item := &Item{Name: "item" + strconv.Itoa(n), CategoryID: category.ID, Image: "a.jpg"}
+				if err := repos[name].Insert(ctx, item); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetAll(b *testing.B) {
+	repos, category := benchmarkRepositories(b)
+	ctx := context.Background()
+	for n := range 100 {
+		item := &Item{Name: "item" + strconv.Itoa(n), CategoryID: category.ID, Image: "a.jpg"}
+		if err := repos["prepared"].Insert(ctx, item); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"unprepared", "prepared"} {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := repos[name].GetAll(ctx, ItemQuery{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// errDeliveryNotClaimed is returned when an attempt is recorded for a delivery which isn't pending under the claim of the caller,
+// e.g. when its lease expired and another worker claimed it again.
+var errDeliveryNotClaimed = errors.New("webhook delivery is not claimed by the caller")
+
+// The states of WebhookDelivery.
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	// deliveryDead is the dead letter state of the deliveries which failed too many times. They are never retried.
+	deliveryDead = "dead"
+)
+
+// Webhook is an endpoint of a partner which is notified of the events of items.
+type Webhook struct {
+	ID         int      `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Secret is the key of the signatures of the payloads, which is only returned when the webhook is registered.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an event in the outbox to be delivered to a webhook.
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	// URL and Secret are the ones of the webhook.
+	URL    string
+	Secret string
+	// EventID is the ID of the event, which is shared by its deliveries to every webhook.
+	EventID   string
+	EventType string
+	Payload   []byte
+	Status    string
+	// Attempts is the number of the failed and the successful attempts so far.
+	Attempts      int
+	NextAttemptAt time.Time
+	// LastError is the error of the last failed attempt.
+	LastError string
+	// ClaimToken identifies the latest claim of the delivery, under which its attempt is recorded.
+	ClaimToken string
+}
+
+// WebhookRepository stores the webhooks and the outbox of their deliveries.
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *Webhook) error
+	// Enqueue writes the event to the outbox once for every webhook of its type.
+	// It joins the transaction of ctx, so that the event is delivered if and only if the change of the item is committed.
+	Enqueue(ctx context.Context, eventID, eventType string, payload []byte) error
+	// ClaimDue returns up to limit pending deliveries whose next attempt is due at now in the order they are due.
+	// Their next attempts are postponed by lease, so that the other workers don't take them while they are delivered,
+	// and they get a new ClaimToken.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+	// MarkDelivered records a successful attempt. It returns errDeliveryNotClaimed unless the delivery is pending under claimToken.
+	MarkDelivered(ctx context.Context, id int, claimToken string) error
+	// MarkFailed records a failed attempt like MarkDelivered.
+	// The delivery is retried at next, or moved to the dead letters when dead is true.
+	MarkFailed(ctx context.Context, id int, claimToken, lastError string, next time.Time, dead bool) error
+	// Deliveries returns the deliveries to a webhook in the order they were enqueued.
+	Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error)
+}
+
+// webhookRepository is an implementation of WebhookRepository
+type webhookRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// NewWebhookRepository creates a new webhookRepository on the SQLite database.
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepository{db: db, dialect: dialectSQLite}
+}
+
+// execer is a queryer running statements as well, i.e. *sql.DB or *sql.Tx.
+type execer interface {
+	queryer
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// conn returns the transaction of ctx, or the pool when there is none.
+func (w *webhookRepository) conn(ctx context.Context) execer {
+	if tx := txFromContext(ctx, w.db); tx != nil {
+		return tx
+	}
+	return w.db
+}
+
+func (w *webhookRepository) Create(ctx context.Context, webhook *Webhook) error {
+	now := currentTime()
+	var id int
+	err := inTx(ctx, w.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, w.dialect.rebind("INSERT INTO webhooks (url, secret, created_at) VALUES (?, ?, ?) RETURNING id"),
+			webhook.URL, webhook.Secret, now).Scan(&id)
+		if err != nil {
+			return err
+		}
+		for _, eventType := range webhook.EventTypes {
+			_, err := tx.ExecContext(ctx, w.dialect.rebind("INSERT INTO webhook_event_types (webhook_id, event_type) VALUES (?, ?)"), id, eventType)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	webhook.ID = id
+	webhook.CreatedAt = now
+	return nil
+}
+
+func (w *webhookRepository) Enqueue(ctx context.Context, eventID, eventType string, payload []byte) error {
+	now := currentTime()
+	return inTx(ctx, w.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, w.dialect.rebind("SELECT webhook_id FROM webhook_event_types WHERE event_type = ? ORDER BY webhook_id"), eventType)
+		if err != nil {
+			return err
+		}
+		var webhookIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			webhookIDs = append(webhookIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, webhookID := range webhookIDs {
+			_, err := tx.ExecContext(ctx, w.dialect.rebind(`INSERT INTO webhook_outbox
+				(webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, 0, ?, ?)`),
+				webhookID, eventID, eventType, string(payload), deliveryPending, now, now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deliveryColumns are the columns scanned by scanDelivery.
+const deliveryColumns = `webhook_outbox.id, webhook_outbox.webhook_id, webhooks.url, webhooks.secret, webhook_outbox.event_id,
+	webhook_outbox.event_type, webhook_outbox.payload, webhook_outbox.status, webhook_outbox.attempts,
+	webhook_outbox.next_attempt_at, webhook_outbox.last_error`
+
+func scanDelivery(rows *sql.Rows) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var payload string
+	var lastError sql.NullString
+	err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &lastError)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	d.LastError = lastError.String
+	return d, nil
+}
+
+// queryDeliveries returns the deliveries selected by query, whose columns are deliveryColumns.
+func queryDeliveries(ctx context.Context, q queryer, query string, args ...any) ([]*WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (w *webhookRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := inTx(ctx, w.db, func(tx *sql.Tx) error {
+		var err error
+		deliveries, err = queryDeliveries(ctx, tx, w.dialect.rebind(`SELECT `+deliveryColumns+`
+			FROM webhook_outbox INNER JOIN webhooks ON webhooks.id = webhook_outbox.webhook_id
+			WHERE webhook_outbox.status = ? AND webhook_outbox.next_attempt_at <= ?
+			ORDER BY webhook_outbox.next_attempt_at, webhook_outbox.id LIMIT ?`+w.dialect.forUpdate()),
+			deliveryPending, now.UTC(), limit)
+		if err != nil {
+			return err
+		}
+		leased := now.Add(lease).UTC()
+		token := rand.Text()
+		for _, d := range deliveries {
+			_, err := tx.ExecContext(ctx, w.dialect.rebind("UPDATE webhook_outbox SET next_attempt_at = ?, claim_token = ? WHERE id = ?"), leased, token, d.ID)
+			if err != nil {
+				return err
+			}
+			d.ClaimToken = token
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (w *webhookRepository) MarkDelivered(ctx context.Context, id int, claimToken string) error {
+	return w.update(ctx, id, claimToken, "status = ?, attempts = attempts + 1, last_error = NULL", deliveryDelivered)
+}
+
+func (w *webhookRepository) MarkFailed(ctx context.Context, id int, claimToken, lastError string, next time.Time, dead bool) error {
+	status := deliveryPending
+	if dead {
+		status = deliveryDead
+	}
+	return w.update(ctx, id, claimToken, "status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?", status, lastError, next.UTC())
+}
+
+// update sets the columns of a delivery which is pending under claimToken.
+func (w *webhookRepository) update(ctx context.Context, id int, claimToken, set string, args ...any) error {
+	query := "UPDATE webhook_outbox SET " + set + " WHERE id = ? AND status = ? AND claim_token = ?"
+	args = append(args, id, deliveryPending, claimToken)
+	res, err := w.conn(ctx).ExecContext(ctx, w.dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errDeliveryNotClaimed
+	}
+	return nil
+}
+
+func (w *webhookRepository) Deliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	return queryDeliveries(ctx, w.conn(ctx), w.dialect.rebind(`SELECT `+deliveryColumns+`
+		FROM webhook_outbox INNER JOIN webhooks ON webhooks.id = webhook_outbox.webhook_id
+		WHERE webhook_outbox.webhook_id = ? ORDER BY webhook_outbox.id`), webhookID)
+}
@@ -14,6 +14,8 @@ func simpleCORSMiddleware(next http.Handler, origin string, methods []string) ht
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ","))
 		w.Header().Set("Access-Control-Allow-Headers", "*")
+		// the headers of the resumable uploads are read by the browsers as well
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Image-Id")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,362 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// migration upgrades a database created by an older version of this application.
+// Migrations run before db/items.sql, which always describes the latest schema,
+// so a migration must bring the existing tables to the shape items.sql expects.
+// A migration must skip the tables which don't exist yet, as items.sql creates them afterwards.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations must be appended in ascending order of version. Never modify a released migration.
+var migrations = []migration{
+	{version: 1, name: "normalize image names", up: normalizeImageNames},
+	{version: 2, name: "add items.phash", up: func(ctx context.Context, tx *sql.Tx) error {
+		return addColumn(ctx, tx, "items", "phash", "INTEGER")
+	}},
+	{version: 3, name: "unique category names and hierarchy", up: uniqueCategories},
+	{version: 4, name: "foreign keys and constraints", up: rebuildWithConstraints},
+	{version: 5, name: "item timestamps and soft delete", up: addItemTimestamps},
+}
+
+// migrate applies the migrations which have not been applied yet.
+// A new database is created by db/items.sql with the latest schema, so all migrations are just marked as applied.
+func migrate(ctx context.Context, db *sql.DB) error {
+	// rebuilding a table requires foreign keys to be disabled, which can't be changed inside a transaction
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	fresh, err := isFreshDB(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA foreign_keys = ON")
+
+	for _, m := range migrations {
+		err := applyMigration(ctx, conn, m, fresh)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// isFreshDB reports whether no table has been created by db/items.sql yet.
+func isFreshDB(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'items'").Scan(&n)
+	return n == 0, err
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration, skip bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if !skip {
+		err = m.up(ctx, tx)
+		if err != nil {
+			return err
+		}
+		slog.Info("applied migration", "version", m.version, "name", m.name)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tableExists reports whether the table exists.
+func tableExists(ctx context.Context, tx *sql.Tx, table string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+// normalizeImageNames rewrites image names stored as paths like "images/<hash>.jpg" to bare file names.
+func normalizeImageNames(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []string{"items", "item_images"} {
+		exists, err := tableExists(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		rows, err := tx.QueryContext(ctx, "SELECT id, image_name FROM "+table)
+		if err != nil {
+			return err
+		}
+
+		names := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+				names[id] = name[i+1:]
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, name := range names {
+			_, err := tx.ExecContext(ctx, "UPDATE "+table+" SET image_name = ? WHERE id = ?", name, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column unless the table already has it, e.g. when the table was created by the latest db/items.sql.
+func addColumn(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// uniqueCategories merges the categories whose names differ only in case, which were created implicitly
+// by POST /items, gives every category a slug and adds the columns for the hierarchy.
+func uniqueCategories(ctx context.Context, tx *sql.Tx) error {
+	err := addColumn(ctx, tx, "categories", "slug", "TEXT")
+	if err != nil {
+		return err
+	}
+	err = addColumn(ctx, tx, "categories", "parent_id", "INTEGER")
+	if err != nil {
+		return err
+	}
+
+	// the oldest category survives
+	_, err = tx.ExecContext(ctx, `UPDATE items SET category_id = (
+		SELECT MIN(c2.id) FROM categories c1 INNER JOIN categories c2 ON c1.name = c2.name COLLATE NOCASE WHERE c1.id = items.category_id
+	) WHERE category_id IN (SELECT id FROM categories)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM categories WHERE id NOT IN (SELECT MIN(id) FROM categories GROUP BY name COLLATE NOCASE)")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, name, slug FROM categories ORDER BY id")
+	if err != nil {
+		return err
+	}
+	slugs := make(map[int]string)
+	used := make(map[string]bool)
+	var missing []int
+	for rows.Next() {
+		var id int
+		var name string
+		var slug sql.NullString
+		if err := rows.Scan(&id, &name, &slug); err != nil {
+			rows.Close()
+			return err
+		}
+		if slug.Valid {
+			used[slug.String] = true
+			continue
+		}
+		slugs[id] = slugify(name)
+		missing = append(missing, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range missing {
+		slug := slugs[id]
+		if slug == "" || used[slug] {
+			// e.g. "phone!" and "phone?" have the same slug
+			slug = strings.TrimPrefix(fmt.Sprintf("%s-%d", slug, id), "-")
+		}
+		used[slug] = true
+		_, err := tx.ExecContext(ctx, "UPDATE categories SET slug = ? WHERE id = ?", slug, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS categories_name_idx ON categories (name COLLATE NOCASE)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS categories_slug_idx ON categories (slug)")
+	return err
+}
+
+// rebuildWithConstraints recreates the tables with the foreign keys, unique and not null constraints of db/items.sql.
+// SQLite can't add constraints to an existing table, so each table is copied into a new one.
+func rebuildWithConstraints(ctx context.Context, tx *sql.Tx) error {
+	// items whose category is missing are moved to a new category instead of being dropped
+	_, err := tx.ExecContext(ctx, `INSERT INTO categories (name, slug)
+		SELECT 'uncategorized', 'uncategorized'
+		WHERE EXISTS (SELECT 1 FROM items WHERE category_id NOT IN (SELECT id FROM categories))
+		AND NOT EXISTS (SELECT 1 FROM categories WHERE slug = 'uncategorized')`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE items SET category_id = (SELECT id FROM categories WHERE slug = 'uncategorized')
+		WHERE category_id NOT IN (SELECT id FROM categories)`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE categories SET parent_id = NULL WHERE parent_id NOT IN (SELECT id FROM categories)")
+	if err != nil {
+		return err
+	}
+
+	tables := []struct {
+		name    string
+		columns string
+		ddl     string
+	}{
+		{
+			name:    "categories",
+			columns: "id, name, slug, parent_id",
+			ddl: `CREATE TABLE new_categories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL COLLATE NOCASE UNIQUE,
+				slug TEXT NOT NULL UNIQUE,
+				parent_id INTEGER REFERENCES categories (id)
+			)`,
+		},
+		{
+			name:    "items",
+			columns: "id, name, category_id, image_name, phash",
+			ddl: `CREATE TABLE new_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				category_id INTEGER NOT NULL REFERENCES categories (id),
+				image_name TEXT NOT NULL,
+				phash INTEGER
+			)`,
+		},
+		{
+			name:    "item_images",
+			columns: "id, item_id, image_name, position",
+			ddl: `CREATE TABLE new_item_images (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				item_id INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+				image_name TEXT NOT NULL,
+				position INTEGER NOT NULL
+			)`,
+		},
+	}
+	for _, t := range tables {
+		exists, err := tableExists(ctx, tx, t.name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		stmts := []string{
+			t.ddl,
+			fmt.Sprintf("INSERT INTO new_%s (%s) SELECT %s FROM %s", t.name, t.columns, t.columns, t.name),
+			"DROP TABLE " + t.name,
+			fmt.Sprintf("ALTER TABLE new_%s RENAME TO %s", t.name, t.name),
+		}
+		if t.name == "item_images" {
+			stmts[1] += " WHERE item_id IN (SELECT id FROM items)"
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return errors.New("foreign key violation remains after the migration")
+	}
+	return rows.Err()
+}
+
+// addItemTimestamps adds created_at, updated_at and deleted_at to items.
+// The creation time of existing items is unknown, so the time of the migration is used.
+func addItemTimestamps(ctx context.Context, tx *sql.Tx) error {
+	// ALTER TABLE requires a constant default for NOT NULL columns, which is overwritten right after
+	for _, column := range []string{"created_at", "updated_at"} {
+		err := addColumn(ctx, tx, "items", column, "DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00'")
+		if err != nil {
+			return err
+		}
+	}
+	err := addColumn(ctx, tx, "items", "deleted_at", "DATETIME")
+	if err != nil {
+		return err
+	}
+
+	now := currentTime()
+	_, err = tx.ExecContext(ctx, "UPDATE items SET created_at = ?, updated_at = ? WHERE created_at = '1970-01-01 00:00:00'", now, now)
+	return err
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// baselineSchema is db/items.sql of the first version, which stored image paths
+// and created categories implicitly from POST /items.
+const baselineSchema = `
+CREATE TABLE IF NOT EXISTS items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	category_id INTEGER NOT NULL,
+	image_name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL
+);`
+
+// setupLegacyDB creates a database with the tables and rows of an older version.
+func setupLegacyDB(t *testing.T, stmts string) *sql.DB {
+	t.Helper()
+
+	f, err := os.CreateTemp(".", "*.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	f.Close()
+	t.Cleanup(func() { removeSQLiteFiles(f.Name()) })
+
+	db, err := sql.Open(sqliteDriverName, sqliteDSN(f.Name()))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(stmts); err != nil {
+		t.Fatalf("failed to set up legacy tables: %v", err)
+	}
+	return db
+}
+
+func queryStrings(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	return got
+}
+
+func TestMigrateBaselineDB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db := setupLegacyDB(t, baselineSchema+`
+		INSERT INTO categories (id, name) VALUES (1, 'phone'), (2, 'Phone'), (3, 'fashion'), (4, 'PHONE'), (5, 'phone!');
+		INSERT INTO items (id, name, category_id, image_name) VALUES
+			(1, 'a', 1, 'images/a.jpg'),
+			(2, 'b', 2, 'images/b.jpg'),
+			(3, 'c', 3, 'c.jpg'),
+			(4, 'd', 4, 'images\d.jpg'),
+			(5, 'e', 9, 'images/e.jpg');`)
+	ctx := context.Background()
+
+	if err := createTables(ctx, db, "../db/items.sql"); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	// migrations are applied only once
+	if err := createTables(ctx, db, "../db/items.sql"); err != nil {
+		t.Fatalf("failed to migrate twice: %v", err)
+	}
+
+	t.Run("image names are bare file names", func(t *testing.T) {
+		got := queryStrings(t, db, "SELECT image_name FROM items ORDER BY id")
+		want := []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected image names (-want +got):\n%s", diff)
+		}
+		got = queryStrings(t, db, "SELECT image_name FROM item_images ORDER BY item_id")
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected item image names (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("duplicated categories are merged", func(t *testing.T) {
+		categories, err := (&categoryRepository{db: db}).GetAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*Category{
+			{ID: 1, Name: "phone", Slug: "phone"},
+			{ID: 3, Name: "fashion", Slug: "fashion"},
+			{ID: 5, Name: "phone!", Slug: "phone-5"},
+			{ID: 6, Name: "uncategorized", Slug: "uncategorized"},
+		}
+		if diff := cmp.Diff(want, categories); diff != "" {
+			t.Errorf("unexpected categories (-want +got):\n%s", diff)
+		}
+
+		got := queryStrings(t, db, "SELECT name || ':' || category_id FROM items ORDER BY id")
+		if diff := cmp.Diff([]string{"a:1", "b:1", "c:3", "d:1", "e:6"}, got); diff != "" {
+			t.Errorf("unexpected item categories (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("existing items have timestamps", func(t *testing.T) {
+		got := queryStrings(t, db, "SELECT id FROM items WHERE created_at = '1970-01-01 00:00:00' OR updated_at < created_at OR deleted_at IS NOT NULL")
+		if len(got) > 0 {
+			t.Errorf("unexpected timestamps of items %v", got)
+		}
+	})
+
+	t.Run("constraints are enforced", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, "INSERT INTO categories (name, slug) VALUES ('FASHION', 'fashion-2')")
+		if err == nil {
+			t.Error("expected a unique constraint error for a name in different case")
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO items (name, category_id, image_name) VALUES ('f', 100, 'f.jpg')")
+		if err == nil {
+			t.Error("expected a foreign key error for a missing category")
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO items (name, category_id, image_name, created_at, updated_at) VALUES ('f', 1, 'f.jpg', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+		if err != nil {
+			t.Errorf("failed to insert an item after the migration: %v", err)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package app
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIDocument is an OpenAPI 3.1 document. Only the fields used by this API are defined.
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*jsonSchema           `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *jsonSchema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+// jsonSchema is a JSON Schema of the 2020-12 draft used by OpenAPI 3.1.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 any                    `json:"type,omitempty"` // a string, or a slice of strings for nullable types
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	ContentMediaType     string                 `json:"contentMediaType,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*jsonSchema          `json:"anyOf,omitempty"`
+}
+
+// apiOperation documents the route of a pattern of http.ServeMux, e.g. "GET /items/{id}".
+type apiOperation struct {
+	Summary string
+	// Admin marks the operations which accept the admin bearer token.
+	Admin bool
+	// PathParams are the schemas of the path parameters in the pattern. They are strings by default.
+	PathParams map[string]*jsonSchema
+	Query      []apiParam
+	Headers    []apiParam
+	// Request is a value of the type of the JSON request body. There is no JSON body when it is nil.
+	Request any
+	// Form is a value of the type of the multipart form body, whose fields are named by their form tags.
+	Form any
+	// RawBody is the media type of a body which is read as is, e.g. a chunk of a file.
+	RawBody string
+	// Responses are the responses keyed by their status codes.
+	Responses map[int]apiResponse
+}
+
+// apiParam is a query or header parameter.
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Schema      *jsonSchema
+}
+
+// apiResponse is a response of an operation.
+type apiResponse struct {
+	// MediaType is the type of the body. There is no body when it is empty.
+	MediaType string
+	// Body is a value of the type of the JSON body. It is ignored unless MediaType is application/json,
+	// and any object is allowed when it is nil.
+	Body any
+}
+
+// jsonResponse is a response whose body is v encoded in JSON.
+func jsonResponse(v any) apiResponse {
+	return apiResponse{MediaType: "application/json", Body: v}
+}
+
+// errorResponse is a response of http.Error, whose body is the error message in plain text.
+var errorResponse = apiResponse{MediaType: "text/plain"}
+
+// pathParamPattern matches the wildcards in patterns of http.ServeMux.
+var pathParamPattern = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// buildOpenAPIDocument builds the document of the operations keyed by the patterns of http.ServeMux.
+func buildOpenAPIDocument(ops map[string]apiOperation) (*openAPIDocument, error) {
+	doc := &openAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: "Mercari Build Training API", Version: "1.0.0"},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			SecuritySchemes: map[string]openAPISecurityScheme{"admin": {Type: "http", Scheme: "bearer"}},
+		},
+	}
+	g := &schemaGenerator{schemas: make(map[string]*jsonSchema)}
+
+	for _, pattern := range slices.Sorted(maps.Keys(ops)) {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			return nil, fmt.Errorf("pattern %q has no method", pattern)
+		}
+		op := ops[pattern]
+		path = pathParamPattern.ReplaceAllString(path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(method)] = g.operation(pattern, op)
+	}
+
+	doc.Components.Schemas = g.schemas
+	return doc, nil
+}
+
+// operation builds the OpenAPI operation of a route.
+func (g *schemaGenerator) operation(pattern string, op apiOperation) *openAPIOperation {
+	o := &openAPIOperation{Summary: op.Summary, Responses: make(map[string]*openAPIResponse)}
+	if op.Admin {
+		// the empty requirement means the token is optional
+		o.Security = []map[string][]string{{"admin": {}}, {}}
+	}
+
+	for _, m := range pathParamPattern.FindAllStringSubmatch(pattern, -1) {
+		schema := op.PathParams[m[1]]
+		if schema == nil {
+			schema = &jsonSchema{Type: "string"}
+		}
+		o.Parameters = append(o.Parameters, &openAPIParameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	for _, p := range op.Query {
+		o.Parameters = append(o.Parameters, &openAPIParameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: p.Schema})
+	}
+	for _, p := range op.Headers {
+		o.Parameters = append(o.Parameters, &openAPIParameter{Name: p.Name, In: "header", Description: p.Description, Required: p.Required, Schema: p.Schema})
+	}
+
+	// an operation with both accepts either of them, which is told apart by Content-Type
+	if op.Request != nil || op.Form != nil || op.RawBody != "" {
+		o.RequestBody = &openAPIRequestBody{Required: true, Content: make(map[string]openAPIMediaType)}
+	}
+	if op.Request != nil {
+		o.RequestBody.Content["application/json"] = openAPIMediaType{Schema: g.schemaOf(reflect.TypeOf(op.Request), "json")}
+	}
+	if op.Form != nil {
+		o.RequestBody.Content["multipart/form-data"] = openAPIMediaType{Schema: g.schemaOf(reflect.TypeOf(op.Form), "form")}
+	}
+	if op.RawBody != "" {
+		o.RequestBody.Content[op.RawBody] = openAPIMediaType{Schema: &jsonSchema{Type: "string", ContentMediaType: op.RawBody}}
+	}
+
+	for code, resp := range op.Responses {
+		r := &openAPIResponse{Description: http.StatusText(code)}
+		switch resp.MediaType {
+		case "":
+		case "application/json":
+			schema := &jsonSchema{Type: "object"}
+			if resp.Body != nil {
+				schema = g.schemaOf(reflect.TypeOf(resp.Body), "json")
+			}
+			r.Content = map[string]openAPIMediaType{resp.MediaType: {Schema: schema}}
+		case "text/plain":
+			r.Content = map[string]openAPIMediaType{resp.MediaType: {Schema: &jsonSchema{Type: "string"}}}
+		default:
+			r.Content = map[string]openAPIMediaType{resp.MediaType: {Schema: &jsonSchema{Type: "string", ContentMediaType: resp.MediaType}}}
+		}
+		o.Responses[strconv.Itoa(code)] = r
+	}
+
+	// requests with invalid parameters or bodies are rejected by requestValidator,
+	// and so are the bodies in undocumented media types when there is a choice of them,
+	// and the JSON bodies larger than maxJSONBodySize
+	if len(o.Parameters) > 0 || o.RequestBody != nil {
+		g.addValidationError(o, http.StatusBadRequest)
+	}
+	if o.RequestBody != nil && len(o.RequestBody.Content) > 1 {
+		g.addValidationError(o, http.StatusUnsupportedMediaType)
+	}
+	if o.RequestBody != nil {
+		if _, ok := o.RequestBody.Content["application/json"]; ok {
+			g.addValidationError(o, http.StatusRequestEntityTooLarge)
+		}
+	}
+	return o
+}
+
+// addValidationError documents ValidationErrorResponse as a response of o with the status code.
+func (g *schemaGenerator) addValidationError(o *openAPIOperation, code int) {
+	r, ok := o.Responses[strconv.Itoa(code)]
+	if !ok {
+		r = &openAPIResponse{Description: http.StatusText(code)}
+		o.Responses[strconv.Itoa(code)] = r
+	}
+	if r.Content == nil {
+		r.Content = make(map[string]openAPIMediaType)
+	}
+	r.Content["application/json"] = openAPIMediaType{Schema: g.schemaOf(reflect.TypeFor[ValidationErrorResponse](), "json")}
+}
+
+// schemaOverrides are the schemas of the types whose JSON encoding is customized.
+var schemaOverrides = map[reflect.Type]jsonSchema{
+	reflect.TypeFor[time.Time]():   {Type: "string", Format: "date-time"},
+	reflect.TypeFor[optionalInt](): {Type: []string{"integer", "null"}},
+}
+
+// schemaGenerator builds the JSON schemas of Go types by reflection.
+// Named struct types of JSON bodies are collected in schemas and referred to by $ref.
+type schemaGenerator struct {
+	schemas map[string]*jsonSchema
+}
+
+// schemaOf returns the schema of t, whose fields are named by the struct tag of the key, e.g. "json" or "form".
+func (g *schemaGenerator) schemaOf(t reflect.Type, key string) *jsonSchema {
+	if s, ok := schemaOverrides[t]; ok {
+		return &s
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.schemaOf(t.Elem(), key))
+	case reflect.Struct:
+		// form bodies are inlined, as their field names differ from the JSON ones
+		if t.Name() == "" || key != "json" {
+			return g.structSchema(t, key)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// the placeholder stops the recursion of types referring to themselves
+			s := &jsonSchema{}
+			g.schemas[t.Name()] = s
+			*s = *g.structSchema(t, key)
+		}
+		return &jsonSchema{Ref: "#/components/schemas/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if key == "form" {
+				return &jsonSchema{Type: "string", ContentMediaType: "application/octet-stream"}
+			}
+			return &jsonSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &jsonSchema{Type: "array", Items: g.schemaOf(t.Elem(), key)}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem(), key)}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Interface:
+		return &jsonSchema{}
+	}
+	panic(fmt.Sprintf("openapi: unsupported type %s", t))
+}
+
+// structSchema returns the schema of the object encoded from the struct t.
+// Fields are required unless they have the omitempty option, as encoding/json always writes them.
+// The option marks the optional fields of requests as well.
+func (g *schemaGenerator) structSchema(t reflect.Type, key string) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema)}
+	for _, f := range reflect.VisibleFields(t) {
+		tag, hasTag := f.Tag.Lookup(key)
+		// fields of embedded structs are promoted like encoding/json does
+		if !f.IsExported() || tag == "-" || (f.Anonymous && !hasTag) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			// only encoding/json names the fields without tags after them
+			if key != "json" {
+				continue
+			}
+			name = f.Name
+		}
+		s.Properties[name] = g.schemaOf(f.Type, key)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// nullable allows null in addition to the values of s.
+func nullable(s *jsonSchema) *jsonSchema {
+	if typ, ok := s.Type.(string); ok {
+		s.Type = []string{typ, "null"}
+		return s
+	}
+	return &jsonSchema{AnyOf: []*jsonSchema{s, {Type: "null"}}}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// patternRecorder records the patterns registered by registerRoutes.
+type patternRecorder struct {
+	patterns []string
+}
+
+func (p *patternRecorder) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	p.patterns = append(p.patterns, pattern)
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	t.Parallel()
+
+	var rec patternRecorder
+	(&Handlers{}).registerRoutes(&rec)
+
+	// routes added to the mux without being documented, or documented routes which were removed, fail here
+	got := slices.Sorted(slices.Values(rec.patterns))
+	want := slices.Sorted(maps.Keys(apiOperations))
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("the registered routes differ from apiOperations (-documented +registered):\n%s", diff)
+	}
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	h := &Handlers{}
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	h.GetOpenAPI(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	body := rr.Body.Bytes()
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("failed to decode the document: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("expected OpenAPI 3.1.0, got %q", doc.OpenAPI)
+	}
+
+	for pattern := range apiOperations {
+		method, path, _ := strings.Cut(pattern, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("expected %s to be documented", pattern)
+		}
+	}
+
+	// every reference is defined in the components
+	var refs []string
+	collectRefs(t, body, &refs)
+	for _, ref := range refs {
+		name, found := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !found || !ok {
+			t.Errorf("expected %s to be defined", ref)
+		}
+	}
+	if len(refs) == 0 {
+		t.Error("expected the types of bodies to be referred to")
+	}
+}
+
+// collectRefs collects the values of $ref in the JSON document.
+func collectRefs(t *testing.T, data []byte, refs *[]string) {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, child := range v {
+				if ref, ok := child.(string); ok && key == "$ref" {
+					*refs = append(*refs, ref)
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+}
+
+func TestSchemaOf(t *testing.T) {
+	t.Parallel()
+
+	type embedded struct {
+		ID int `json:"id"`
+	}
+	type example struct {
+		*embedded
+		Name     string     `json:"name"`
+		Note     string     `json:"note,omitempty"`
+		ParentID *int       `json:"parent_id"`
+		Tags     []string   `json:"tags"`
+		Created  time.Time  `json:"created"`
+		Image    []byte     `json:"image" form:"image"`
+		Ignored  string     `json:"-"`
+		Nested   *Category  `json:"nested"`
+		Deleted  *time.Time `json:"deleted,omitempty"`
+	}
+
+	cases := map[string]struct {
+		key  string
+		want *jsonSchema
+	}{
+		"json": {
+			key: "json",
+			want: &jsonSchema{
+				Type: "object",
+				Properties: map[string]*jsonSchema{
+					"id":        {Type: "integer"},
+					"name":      {Type: "string"},
+					"note":      {Type: "string"},
+					"parent_id": {Type: []string{"integer", "null"}},
+					"tags":      {Type: "array", Items: &jsonSchema{Type: "string"}},
+					"created":   {Type: "string", Format: "date-time"},
+					"image":     {Type: "string", ContentEncoding: "base64"},
+					"nested":    {AnyOf: []*jsonSchema{{Ref: "#/components/schemas/Category"}, {Type: "null"}}},
+					"deleted":   {Type: []string{"string", "null"}, Format: "date-time"},
+				},
+				Required: []string{"id", "name", "parent_id", "tags", "created", "image", "nested"},
+			},
+		},
+		"form": {
+			key: "form",
+			want: &jsonSchema{
+				Type: "object",
+				Properties: map[string]*jsonSchema{
+					"image": {Type: "string", ContentMediaType: "application/octet-stream"},
+				},
+				Required: []string{"image"},
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			g := &schemaGenerator{schemas: make(map[string]*jsonSchema)}
+			got := g.structSchema(reflect.TypeFor[example](), tt.key)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected schema (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
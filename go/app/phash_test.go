@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage draws a 64x48 image whose brightness is given by f.
+func testImage(t *testing.T, f func(x, y int) uint8) image.Image {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: f(x, y)})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestPerceptualHash(t *testing.T) {
+	t.Parallel()
+
+	waves := func(x, y int) uint8 { return uint8((x*x + 3*y*y + x*y) % 256) }
+	original := encodePNG(t, testImage(t, waves))
+
+	cases := map[string]struct {
+		image       []byte
+		maxDistance int
+		minDistance int
+		err         bool
+	}{
+		"ok: same image": {
+			image:       original,
+			maxDistance: 0,
+		},
+		"ok: re-encoded as a low quality JPEG": {
+			image:       encodeJPEG(t, testImage(t, waves), 30),
+			maxDistance: defaultSimilarityThreshold,
+		},
+		"ok: a few pixels are edited": {
+			image: encodePNG(t, testImage(t, func(x, y int) uint8 {
+				if x < 4 && y < 4 {
+					return 255
+				}
+				return waves(x, y)
+			})),
+			maxDistance: defaultSimilarityThreshold,
+		},
+		"ok: different image": {
+			image:       encodePNG(t, testImage(t, func(x, y int) uint8 { return uint8(x * 4) })),
+			maxDistance: 64,
+			minDistance: defaultSimilarityThreshold + 1,
+		},
+		"ng: not an image": {
+			image: []byte("test image data"),
+			err:   true,
+		},
+	}
+
+	want, err := perceptualHash(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := perceptualHash(tt.image)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatal("expected an error, got nil")
+			}
+
+			d := hammingDistance(want, got)
+			if d > tt.maxDistance || d < tt.minDistance {
+				t.Errorf("unexpected distance %d, want between %d and %d", d, tt.minDistance, tt.maxDistance)
+			}
+		})
+	}
+}
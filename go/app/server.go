@@ -1,23 +1,52 @@
 package app
 
 import (
+	"context"
 	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Server struct {
 	// Port is the port number to listen on.
 	Port string
+	// GRPCPort is the port number of the gRPC CatalogService. It isn't served when it is empty.
+	GRPCPort string
 	// ImageDirPath is the path to the directory storing images.
 	ImageDirPath string
+	// PublicBaseURL is the base URL the clients use to reach this server, e.g. "https://api.example.com".
+	// It is used to build absolute image URLs in responses.
+	PublicBaseURL string
+	// AdminToken is the bearer token of admins, who can see soft-deleted items.
+	// Admin-only features are disabled when it is empty.
+	AdminToken string
+	// ClientTokens are the bearer tokens of the apps connecting to the WebSocket of the item changes.
+	// The WebSocket only accepts AdminToken when it is empty.
+	ClientTokens []string
+	// Storage selects the database storing items and categories.
+	Storage StorageConfig
+	// ImageGCInterval is the interval of the orphaned image garbage collection.
+	// The garbage collection is disabled when it is zero.
+	ImageGCInterval time.Duration
+	// UploadTTL is how long an incomplete resumable upload is kept after its last chunk.
+	// DefaultUploadTTL is used when it is zero.
+	UploadTTL time.Duration
 }
 
 // Run is a method to start the server.
@@ -36,22 +65,95 @@ func (s Server) Run() int {
 	}
 
 	// STEP 5-1: set up the database connection
+	storage, err := OpenStorage(context.Background(), s.Storage)
+	if err != nil {
+		slog.Error("failed to open database: ", "error", err)
+		return 1
+	}
+	defer storage.Close()
 
 	// set up handlers
-	itemRepo := NewItemRepository()
-	h := &Handlers{imgDirPath: s.ImageDirPath, itemRepo: itemRepo}
+	itemRepo := storage.Items
+	h := &Handlers{
+		imgDirPath:    s.ImageDirPath,
+		publicBaseURL: s.PublicBaseURL,
+		adminToken:    s.AdminToken,
+		clientTokens:  s.ClientTokens,
+		itemRepo:      itemRepo,
+		categoryRepo:  storage.Categories,
+		webhookRepo:   storage.Webhooks,
+		txManager:     storage.Tx,
+		dbStats:       storage.Stats,
+		events:        newEventBroker(defaultEventHistory, defaultSubscriberBuffer),
+	}
+	// the items written through the handlers are sent to the webhooks, and pushed to the streams and the WebSocket clients
+	outbox := &outboxItemRepository{ItemRepository: itemRepo, tx: storage.Tx, enqueue: h.enqueueWebhookEvent}
+	h.itemRepo = &publishingItemRepository{ItemRepository: outbox, publish: h.publishItemEvent}
+
+	// the resumable uploads are kept next to the images, so that the complete ones are stored on the same file system
+	h.uploads, err = newUploadStore(filepath.Join(s.ImageDirPath, ".uploads"), h.storeImage)
+	if err != nil {
+		slog.Error("failed to set up resumable uploads: ", "error", err)
+		return 1
+	}
+	uploadTTL := s.UploadTTL
+	if uploadTTL == 0 {
+		uploadTTL = DefaultUploadTTL
+	}
+	go h.uploads.runCleanupPeriodically(context.Background(), uploadTTL)
+
+	// run the orphaned image garbage collection in background
+	if s.ImageGCInterval > 0 {
+		gc := &ImageGC{
+			ImgDirPath:  s.ImageDirPath,
+			ItemRepo:    itemRepo,
+			GracePeriod: DefaultImageGCGracePeriod,
+		}
+		go gc.RunPeriodically(context.Background(), s.ImageGCInterval)
+	}
+
+	// deliver the events in the outbox to the webhooks in background
+	webhooks := &WebhookWorker{
+		Repo:        storage.Webhooks,
+		Client:      &http.Client{},
+		Timeout:     DefaultWebhookTimeout,
+		MaxAttempts: DefaultWebhookMaxAttempts,
+		Backoff:     DefaultWebhookBackoff,
+		MaxBackoff:  DefaultWebhookMaxBackoff,
+		BatchSize:   DefaultWebhookBatchSize,
+	}
+	go webhooks.RunPeriodically(context.Background(), DefaultWebhookInterval)
 
 	// set up routes
+	// requests are validated against the OpenAPI document before they reach the handlers
+	validator, err := newRequestValidator(apiOperations)
+	if err != nil {
+		slog.Error("failed to build OpenAPI document: ", "error", err)
+		return 1
+	}
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /", h.Hello)
-	mux.HandleFunc("POST /items", h.AddItem)
-	mux.HandleFunc("GET /items", h.GetItems)
-	mux.HandleFunc("GET /images/{filename}", h.GetImage)
-	mux.HandleFunc("GET /items/{id}", h.GetItemByID)
+	h.registerRoutes(validatingMux{mux: newVersionedMux(mux), v: validator})
+
+	// the gRPC service is served on its own port next to the HTTP API
+	if s.GRPCPort != "" {
+		lis, err := net.Listen("tcp", ":"+s.GRPCPort)
+		if err != nil {
+			slog.Error("failed to listen for gRPC: ", "error", err)
+			return 1
+		}
+		grpcServer := newGRPCServer(h)
+		defer grpcServer.GracefulStop()
+		go func() {
+			slog.Info("grpc server started on", "port", s.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				slog.Error("failed to serve gRPC: ", "error", err)
+			}
+		}()
+	}
 
 	// start the server
 	slog.Info("http server started on", "port", s.Port)
-	err := http.ListenAndServe(":"+s.Port, simpleCORSMiddleware(simpleLoggerMiddleware(mux), frontURL, []string{"GET", "HEAD", "POST", "OPTIONS"}))
+	err = http.ListenAndServe(":"+s.Port, simpleCORSMiddleware(simpleLoggerMiddleware(mux), frontURL, []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}))
 	if err != nil {
 		slog.Error("failed to start server: ", "error", err)
 		return 1
@@ -63,7 +165,72 @@ func (s Server) Run() int {
 type Handlers struct {
 	// imgDirPath is the path to the directory storing images.
 	imgDirPath string
-	itemRepo   ItemRepository
+	// publicBaseURL is the base URL used to build absolute image URLs.
+	publicBaseURL string
+	// adminToken is the bearer token of admins.
+	adminToken string
+	// clientTokens are the bearer tokens of the clients of the WebSocket, which accepts adminToken as well.
+	clientTokens []string
+	itemRepo     ItemRepository
+	categoryRepo CategoryRepository
+	// webhookRepo has the outbox of the webhooks, which itemRepo writes to.
+	webhookRepo WebhookRepository
+	// txManager runs the changes across the repositories atomically. They run without a transaction when it is nil.
+	txManager TxManager
+	// dbStats returns the statistics of the database connection pools.
+	dbStats func() map[string]sql.DBStats
+	// uploads keeps the resumable uploads until they are complete.
+	uploads *uploadStore
+	// events delivers the changes of items to the streams. itemRepo publishes to it.
+	events *eventBroker
+	// streamHeartbeat is the interval of the heartbeats of the streams. defaultStreamHeartbeat is used when it is zero.
+	streamHeartbeat time.Duration
+}
+
+// withinTx runs fn in a transaction of txManager if there is one.
+func (s *Handlers) withinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.txManager == nil {
+		return fn(ctx)
+	}
+	return s.txManager.WithinTx(ctx, fn)
+}
+
+// routeRegistrar is implemented by *http.ServeMux.
+type routeRegistrar interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// registerRoutes registers the handlers of the API. Every route must be documented in apiOperations.
+func (s *Handlers) registerRoutes(mux routeRegistrar) {
+	mux.HandleFunc("GET /", s.Hello)
+	mux.HandleFunc("GET /openapi.json", s.GetOpenAPI)
+	mux.HandleFunc("POST /items", s.AddItem)
+	mux.HandleFunc("GET /items", s.GetItems)
+	mux.HandleFunc("GET /items/stream", s.StreamItems)
+	mux.HandleFunc("GET /items/ws", s.ItemsWebSocket)
+	mux.HandleFunc("GET /images/{filename}", s.GetImage)
+	mux.HandleFunc("POST /uploads", s.UploadImage)
+	mux.HandleFunc("POST /uploads/resumable", s.CreateUpload)
+	mux.HandleFunc("HEAD /uploads/resumable/{id}", s.GetUploadOffset)
+	mux.HandleFunc("PATCH /uploads/resumable/{id}", s.PatchUpload)
+	mux.HandleFunc("GET /items/{id}", s.GetItemByID)
+	mux.HandleFunc("DELETE /items/{id}", s.DeleteItem)
+	mux.HandleFunc("GET /items/{id}/similar", s.GetSimilarItems)
+	mux.HandleFunc("POST /items/{id}/images", s.AddItemImages)
+	mux.HandleFunc("PUT /items/{id}/images/order", s.ReorderItemImages)
+	mux.HandleFunc("DELETE /items/{id}/images/{image_id}", s.DeleteItemImage)
+	mux.HandleFunc("GET /categories", s.GetCategories)
+	mux.HandleFunc("POST /categories", s.AddCategory)
+	mux.HandleFunc("GET /categories/{id}", s.GetCategory)
+	mux.HandleFunc("PATCH /categories/{id}", s.UpdateCategory)
+	mux.HandleFunc("DELETE /categories/{id}", s.DeleteCategory)
+	mux.HandleFunc("GET /categories/{id}/items", s.GetCategoryItems)
+	mux.HandleFunc("GET /debug/db/stats", s.GetDBStats)
+	mux.HandleFunc("POST /webhooks", s.AddWebhook)
+
+	graphql := s.newGraphQLHandler()
+	mux.HandleFunc("GET /graphql", graphql)
+	mux.HandleFunc("POST /graphql", graphql)
 }
 
 type HelloResponse struct {
@@ -73,22 +240,31 @@ type HelloResponse struct {
 // Hello is a handler to return a Hello, world! message for GET / .
 func (s *Handlers) Hello(w http.ResponseWriter, r *http.Request) {
 	resp := HelloResponse{Message: "Hello, world!"}
-	err := json.NewEncoder(w).Encode(resp)
+	err := writeJSON(w, r, resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// GetItems is a handler to list items for GET /items .
+// sort=newest sorts items by creation time, and include_deleted=true, which is admin-only, includes soft-deleted items.
 func (s *Handlers) GetItems(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	resp, err := s.itemRepo.GetAll(ctx)
+	query, code, err := s.parseItemQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	resp, err := s.itemRepo.GetAll(ctx, query)
 	if err != nil {
 		slog.Error("failed to get items: ", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = json.NewEncoder(w).Encode(resp)
+	s.setImageURLs(ctx, resp.Items...)
+	err = writeJSON(w, r, resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -96,99 +272,253 @@ func (s *Handlers) GetItems(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// AddItemRequest is the body of POST /items, which is sent either in a multipart form or in JSON.
+// The images are sent as files or in base64, or they refer to the images uploaded to POST /uploads beforehand.
 type AddItemRequest struct {
-	Name     string `form:"name"`
-	Category string `form:"category"` // STEP 4-2: add a category field
-	Image    []byte `form:"image"`    // STEP 4-4: add an image field
+	Name       string   `form:"name" json:"name"`
+	CategoryID int      `form:"category_id,omitempty" json:"category_id,omitempty"`
+	Category   string   `form:"category,omitempty" json:"category,omitempty"` // STEP 4-2: add a category field. It is the slug or the name of the category.
+	Images     [][]byte `form:"image,omitempty" json:"images,omitempty"`      // STEP 4-4: add an image field
+	ImageIDs   []string `form:"image_id,omitempty" json:"image_ids,omitempty"`
 }
 
 type AddItemResponse struct {
 	Message string `json:"message"`
+	// Warning is set when a listing with a near-duplicate image already exists.
+	Warning        string `json:"warning,omitempty"`
+	SimilarItemIDs []int  `json:"similar_item_ids,omitempty"`
 }
 
+// errUnsupportedMediaType is returned when the body of POST /items is neither a multipart form nor JSON.
+var errUnsupportedMediaType = errors.New("Content-Type must be multipart/form-data or application/json")
+
+// maxJSONBodySize limits the JSON bodies, e.g. of POST /items, which requestValidator reads in memory.
+// It is larger than the multipart form as base64 makes the images a third larger.
+const maxJSONBodySize = 48 << 20
+
 // parseAddItemRequest parses and validates the request to add an item.
+// The parser is chosen by Content-Type, and both bodies are validated by the same rules.
 func parseAddItemRequest(r *http.Request) (*AddItemRequest, error) {
-	file, _, err := r.FormFile("image")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var req *AddItemRequest
+	var err error
+	switch mediaType {
+	case "multipart/form-data":
+		req, err = parseAddItemForm(r)
+	case "application/json":
+		req, err = parseAddItemJSON(r)
+	default:
+		return nil, errUnsupportedMediaType
+	}
 	if err != nil {
-		return nil, errors.New("image is required")
+		return nil, err
 	}
-	defer file.Close()
 
-	fileBytes, err := io.ReadAll(file)
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// parseAddItemForm parses the multipart form of POST /items .
+func parseAddItemForm(r *http.Request) (*AddItemRequest, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, errors.New("invalid multipart form")
+	}
+	images, err := readFormFiles(r.MultipartForm.File["image"])
 	if err != nil {
-		return nil, errors.New("failed to read image")
+		return nil, err
 	}
 
 	req := &AddItemRequest{
 		Name:     r.FormValue("name"),
 		Category: r.FormValue("category"),
-		Image:    fileBytes,
+		Images:   images,
+		ImageIDs: r.MultipartForm.Value["image_id"],
 	}
+	if v := r.FormValue("category_id"); v != "" {
+		req.CategoryID, err = strconv.Atoi(v)
+		if err != nil || req.CategoryID <= 0 {
+			return nil, errors.New("category_id must be a positive integer")
+		}
+	}
+	return req, nil
+}
 
-	if req.Name == "" {
-		return nil, errors.New("name is required")
+// parseAddItemJSON parses the JSON body of POST /items, whose images are encoded in base64.
+func parseAddItemJSON(r *http.Request) (*AddItemRequest, error) {
+	var req AddItemRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxJSONBodySize)).Decode(&req); err != nil {
+		return nil, errors.New("invalid request body")
 	}
+	return &req, nil
+}
 
-	if req.Category == "" {
-		return nil, errors.New("category is required")
+// validate checks the request regardless of the format it was sent in.
+func (req *AddItemRequest) validate() error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if req.CategoryID < 0 {
+		return errors.New("category_id must be a positive integer")
+	}
+	if req.CategoryID == 0 && req.Category == "" {
+		return errors.New("category_id or category is required")
+	}
+	if len(req.Images) > 0 && len(req.ImageIDs) > 0 {
+		return errors.New("images and image IDs can't be sent together")
 	}
+	n := len(req.Images) + len(req.ImageIDs)
+	if n == 0 {
+		return errors.New("image is required")
+	}
+	if n > maxImagesPerItem {
+		return errTooManyImages
+	}
+	return nil
+}
 
-	if req.Image == nil {
+// readImageFiles reads the files sent under the repeated "image" form field in the order they were sent.
+func readImageFiles(r *http.Request) ([][]byte, error) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		return nil, errors.New("image is required")
 	}
-	return req, nil
+	headers := r.MultipartForm.File["image"]
+	if len(headers) == 0 {
+		return nil, errors.New("image is required")
+	}
+	return readFormFiles(headers)
+}
+
+// readFormFiles reads the contents of the uploaded files.
+func readFormFiles(headers []*multipart.FileHeader) ([][]byte, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > maxImagesPerItem {
+		return nil, errTooManyImages
+	}
+	images := make([][]byte, 0, len(headers))
+	for _, fh := range headers {
+		file, err := fh.Open()
+		if err != nil {
+			return nil, errors.New("failed to read image")
+		}
+		fileBytes, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, errors.New("failed to read image")
+		}
+		images = append(images, fileBytes)
+	}
+	return images, nil
 }
 
 // AddItem is a handler to add a new item for POST /items .
 func (s *Handlers) AddItem(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	req, err := parseAddItemRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		code := http.StatusBadRequest
+		if errors.Is(err, errUnsupportedMediaType) {
+			code = http.StatusUnsupportedMediaType
+		}
+		http.Error(w, err.Error(), code)
 		return
 	}
 
-	fileName, err := s.storeImage(req.Image)
+	item, similar, err := s.addItem(r.Context(), req)
 	if err != nil {
-		slog.Error("failed to store image: ", "error", err)
+		if errors.Is(err, errImageNotFound) || errors.Is(err, errCategoryNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to add item: ", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	item := &Item{
-		Name:     req.Name,
-		Category: req.Category,
-		Image:    fileName,
-	}
 	message := fmt.Sprintf("item received: %s", item.Name)
 	slog.Info(message)
+	resp := AddItemResponse{Message: message}
+	for _, si := range similar {
+		resp.SimilarItemIDs = append(resp.SimilarItemIDs, si.ID)
+	}
+	if len(similar) > 0 {
+		resp.Warning = "a listing with a similar image already exists"
+	}
 
-	err = s.itemRepo.Insert(ctx, item)
+	err = writeJSON(w, r, resp)
 	if err != nil {
-		slog.Error("failed to store item: ", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
 
-	resp := AddItemResponse{Message: message}
-	err = json.NewEncoder(w).Encode(resp)
+// addItem stores the images of a validated request and inserts its item, which is shared by POST /items and the gRPC service.
+// It returns the items whose cover image looks like the new one as well.
+// The errors caused by the request wrap errImageNotFound or errCategoryNotFound.
+func (s *Handlers) addItem(ctx context.Context, req *AddItemRequest) (*Item, []*SimilarItem, error) {
+	if len(req.ImageIDs) > 0 {
+		images, err := s.loadUploadedImages(req.ImageIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Images = images
+	}
+
+	category, err := s.findCategory(ctx, req.CategoryID, req.Category)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	images, err := s.storeImages(req.Images)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store image: %w", err)
 	}
+
+	item := &Item{
+		Name:       req.Name,
+		CategoryID: category.ID,
+		Category:   category.Name,
+		Images:     images,
+	}
+
+	// the perceptual hash is optional, as images which can't be decoded are accepted as well
+	var similar []*SimilarItem
+	hash, err := perceptualHash(req.Images[0])
+	if err != nil {
+		slog.Debug("failed to compute perceptual hash", "error", err)
+	} else {
+		item.PerceptualHash = &hash
+		similar, err = s.itemRepo.FindSimilar(ctx, hash, defaultSimilarityThreshold)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to find similar items: %w", err)
+		}
+	}
+
+	err = s.itemRepo.Insert(ctx, item)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store item: %w", err)
+	}
+	return item, similar, nil
 }
 
-// storeImage stores an image and returns the file path and an error if any.
+// storeImage stores an image and returns the file name and an error if any.
 // this method calculates the hash sum of the image as a file name to avoid the duplication of a same file
 // and stores it in the image directory.
-func (s *Handlers) storeImage(image []byte) (filePath string, err error) {
+// The returned file name doesn't contain the directory, so it can be used as is in GET /images/{filename} .
+func (s *Handlers) storeImage(image []byte) (fileName string, err error) {
 	hash := sha256.Sum256(image)
-	filePath = filepath.Join(s.imgDirPath, fmt.Sprintf("%x.jpg", hash))
+	fileName = fmt.Sprintf("%x.jpg", hash)
+	filePath := filepath.Join(s.imgDirPath, fileName)
 
-	_, err = os.Stat(filePath)
+	// the modification time of an existing file is renewed,
+	// so that ImageGC gives the item which is about to refer to it the whole grace period
+	now := time.Now()
+	err = os.Chtimes(filePath, now, now)
 	if err == nil {
-		return filePath, nil
+		return fileName, nil
 	}
 	if !os.IsNotExist(err) {
 		return "", err
@@ -199,7 +529,76 @@ func (s *Handlers) storeImage(image []byte) (filePath string, err error) {
 		return "", err
 	}
 
-	return filePath, nil
+	return fileName, nil
+}
+
+// storeImages stores every image and returns them as item images in the same order.
+func (s *Handlers) storeImages(images [][]byte) ([]*ItemImage, error) {
+	stored := make([]*ItemImage, 0, len(images))
+	for _, image := range images {
+		fileName, err := s.storeImage(image)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, &ItemImage{Name: fileName})
+	}
+	return stored, nil
+}
+
+// UploadImageResponse is the response of POST /uploads .
+type UploadImageResponse struct {
+	// ImageID refers to the image in POST /items . It is the file name of the image, which is served at URL.
+	ImageID string `json:"image_id"`
+	URL     string `json:"url"`
+}
+
+// UploadImage is a handler to upload an image ahead of POST /items for POST /uploads .
+// Uploaded images which aren't referred to by any item are removed by the image garbage collection
+// once they are older than its grace period.
+func (s *Handlers) UploadImage(w http.ResponseWriter, r *http.Request) {
+	images, err := readImageFiles(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(images) != 1 {
+		http.Error(w, "exactly one image is required", http.StatusBadRequest)
+		return
+	}
+
+	fileName, err := s.storeImage(images[0])
+	if err != nil {
+		slog.Error("failed to store image: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = writeJSON(w, r, UploadImageResponse{ImageID: fileName, URL: s.imageURL(r.Context(), fileName)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// loadUploadedImages reads the images uploaded to POST /uploads in the order of the IDs.
+// Only the names generated by storeImage are accepted, so the IDs can't point outside the image directory.
+func (s *Handlers) loadUploadedImages(ids []string) ([][]byte, error) {
+	images := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		if !hashedImageNamePattern.MatchString(id) {
+			return nil, fmt.Errorf("%w: %s", errImageNotFound, id)
+		}
+		image, err := os.ReadFile(filepath.Join(s.imgDirPath, id))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: %s", errImageNotFound, id)
+			}
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
 }
 
 type GetImageRequest struct {
@@ -243,10 +642,34 @@ func (s *Handlers) GetImage(w http.ResponseWriter, r *http.Request) {
 		imgPath = filepath.Join(s.imgDirPath, "default.jpg")
 	}
 
+	setImageCacheHeaders(w, filepath.Base(imgPath))
 	slog.Info("returned image", "path", imgPath)
+	// http.ServeFile answers conditional requests with 304 Not Modified using the ETag set above.
 	http.ServeFile(w, r, imgPath)
 }
 
+const (
+	// hashedImageCacheControl is used for images named after their content hash, which never change.
+	hashedImageCacheControl = "public, max-age=31536000, immutable"
+	// fallbackImageCacheControl is used for the default image and other files whose content may change.
+	fallbackImageCacheControl = "public, max-age=300"
+)
+
+// hashedImageNamePattern matches the file names generated by storeImage.
+var hashedImageNamePattern = regexp.MustCompile(`^([0-9a-f]{64})\.jpe?g$`)
+
+// setImageCacheHeaders sets the caching headers for the image file name.
+// Images stored by storeImage are content-addressed, so the hash is used as a strong ETag.
+func setImageCacheHeaders(w http.ResponseWriter, fileName string) {
+	m := hashedImageNamePattern.FindStringSubmatch(fileName)
+	if m == nil {
+		w.Header().Set("Cache-Control", fallbackImageCacheControl)
+		return
+	}
+	w.Header().Set("ETag", `"`+m[1]+`"`)
+	w.Header().Set("Cache-Control", hashedImageCacheControl)
+}
+
 // buildImagePath builds the image path and validates it.
 func (s *Handlers) buildImagePath(imageFileName string) (string, error) {
 	imgPath := filepath.Join(s.imgDirPath, filepath.Clean(imageFileName))
@@ -280,7 +703,235 @@ func (s *Handlers) GetItemByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := s.itemRepo.GetByID(ctx, id)
+	query, code, err := s.parseItemQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	item, err := s.itemRepo.GetByID(ctx, id, query)
+	if err != nil {
+		if errors.Is(err, errItemNotFound) {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get item: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.setImageURLs(ctx, item)
+
+	err = writeJSON(w, r, item)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// imageURL builds the absolute URL of GET /images/{filename} for the stored image name
+// under the version of the request, so that clients stay on the version they call.
+func (s *Handlers) imageURL(ctx context.Context, imageName string) string {
+	return strings.TrimSuffix(s.publicBaseURL, "/") + "/" + apiVersionFromContext(ctx).Name + "/images/" + url.PathEscape(imageName)
+}
+
+// setImageURLs fills the image URLs of items.
+func (s *Handlers) setImageURLs(ctx context.Context, items ...*Item) {
+	for _, item := range items {
+		item.ImageURL = s.imageURL(ctx, item.Image)
+		s.setItemImageURLs(ctx, item.Images)
+	}
+}
+
+// setItemImageURLs fills the URLs of item images.
+func (s *Handlers) setItemImageURLs(ctx context.Context, images []*ItemImage) {
+	for _, img := range images {
+		img.URL = s.imageURL(ctx, img.Name)
+	}
+}
+
+type ItemImagesResponse struct {
+	Images []*ItemImage `json:"images"`
+}
+
+// parseItemID parses the item ID in the path.
+func parseItemID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+// writeItemImagesError maps errors from the image operations of ItemRepository to HTTP responses.
+func writeItemImagesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errItemNotFound), errors.Is(err, errItemImageNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errTooManyImages), errors.Is(err, errLastImage), errors.Is(err, errInvalidImageOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("failed to update item images: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AddItemImages is a handler to append images to an item for POST /items/{id}/images .
+func (s *Handlers) AddItemImages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID, err := parseItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, err := readImageFiles(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored, err := s.storeImages(files)
+	if err != nil {
+		slog.Error("failed to store image: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := make([]string, 0, len(stored))
+	for _, img := range stored {
+		names = append(names, img.Name)
+	}
+
+	images, err := s.itemRepo.AddImages(ctx, itemID, names)
+	if err != nil {
+		writeItemImagesError(w, err)
+		return
+	}
+	s.setItemImageURLs(ctx, images)
+
+	err = writeJSON(w, r, ItemImagesResponse{Images: images})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type ReorderItemImagesRequest struct {
+	ImageIDs []int `json:"image_ids"`
+}
+
+// ReorderItemImages is a handler to change the order of item images for PUT /items/{id}/images/order .
+// The first image in the new order becomes the cover image.
+func (s *Handlers) ReorderItemImages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID, err := parseItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req ReorderItemImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ImageIDs) == 0 {
+		http.Error(w, "image_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	images, err := s.itemRepo.ReorderImages(ctx, itemID, req.ImageIDs)
+	if err != nil {
+		writeItemImagesError(w, err)
+		return
+	}
+	s.updateCoverImageHash(ctx, itemID, images[0].Name)
+	s.setItemImageURLs(ctx, images)
+
+	err = writeJSON(w, r, ItemImagesResponse{Images: images})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// updateCoverImageHash recomputes the perceptual hash of the item after its images changed,
+// so that FindSimilar doesn't compare the image which was the cover before.
+// The hash is only written while the cover is still coverName, as a change which replaced it in the meantime
+// writes the hash of its own cover.
+// The hash is cleared when the cover image can't be decoded, which POST /items accepts as well.
+// A failure is only logged, as the change of the images has already been saved.
+func (s *Handlers) updateCoverImageHash(ctx context.Context, itemID int, coverName string) {
+	var hash *uint64
+	if h, err := s.coverImageHash(coverName); err != nil {
+		slog.Debug("failed to compute perceptual hash", "error", err)
+	} else {
+		hash = &h
+	}
+	if err := s.itemRepo.UpdatePerceptualHash(ctx, itemID, coverName, hash); err != nil {
+		slog.Error("failed to update perceptual hash", "item_id", itemID, "error", err)
+	}
+}
+
+// coverImageHash computes the perceptual hash of a stored image.
+func (s *Handlers) coverImageHash(name string) (uint64, error) {
+	image, err := os.ReadFile(filepath.Join(s.imgDirPath, name))
+	if err != nil {
+		return 0, err
+	}
+	return perceptualHash(image)
+}
+
+// DeleteItemImage is a handler to remove an image from an item for DELETE /items/{id}/images/{image_id} .
+// The image file itself is kept because other items may share it.
+func (s *Handlers) DeleteItemImage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID, err := parseItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	imageID, err := strconv.Atoi(r.PathValue("image_id"))
+	if err != nil || imageID <= 0 {
+		http.Error(w, "image_id must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	images, err := s.itemRepo.DeleteImage(ctx, itemID, imageID)
+	if err != nil {
+		writeItemImagesError(w, err)
+		return
+	}
+	s.updateCoverImageHash(ctx, itemID, images[0].Name)
+	s.setItemImageURLs(ctx, images)
+
+	err = writeJSON(w, r, ItemImagesResponse{Images: images})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type SimilarItemsResponse struct {
+	Items []*SimilarItem `json:"items"`
+}
+
+// GetSimilarItems is a handler to list the items whose cover image looks like the one of an item
+// for GET /items/{id}/similar . The threshold query parameter is the maximum Hamming distance.
+func (s *Handlers) GetSimilarItems(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID, err := parseItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	threshold := defaultSimilarityThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		threshold, err = strconv.Atoi(v)
+		if err != nil || threshold < 0 || threshold > 64 {
+			http.Error(w, "threshold must be an integer between 0 and 64", http.StatusBadRequest)
+			return
+		}
+	}
+
+	item, err := s.itemRepo.GetByID(ctx, strconv.Itoa(itemID), ItemQuery{})
 	if err != nil {
 		if errors.Is(err, errItemNotFound) {
 			http.Error(w, "item not found", http.StatusNotFound)
@@ -291,9 +942,91 @@ func (s *Handlers) GetItemByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(item)
+	resp := SimilarItemsResponse{Items: []*SimilarItem{}}
+	if item.PerceptualHash != nil {
+		similar, err := s.itemRepo.FindSimilar(ctx, *item.PerceptualHash, threshold)
+		if err != nil {
+			slog.Error("failed to find similar items: ", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, si := range similar {
+			if si.ID == item.ID {
+				continue
+			}
+			s.setImageURLs(ctx, si.Item)
+			resp.Items = append(resp.Items, si)
+		}
+	}
+
+	err = writeJSON(w, r, resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// isAdmin reports whether the request has the admin bearer token.
+func (s *Handlers) isAdmin(r *http.Request) bool {
+	return s.isAdminAuthorization(r.Header.Get("Authorization"))
+}
+
+// isAdminAuthorization reports whether the value of an Authorization header has the admin bearer token.
+func (s *Handlers) isAdminAuthorization(authorization string) bool {
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	return found && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// parseItemQuery parses the query parameters to get items.
+// It returns the status code to respond with when the parameters are invalid.
+func (s *Handlers) parseItemQuery(r *http.Request) (ItemQuery, int, error) {
+	var query ItemQuery
+	params := r.URL.Query()
+
+	switch params.Get("sort") {
+	case "", "id":
+	case "newest":
+		query.Newest = true
+	default:
+		return query, http.StatusBadRequest, errors.New("sort must be id or newest")
+	}
+
+	if v := params.Get("include_deleted"); v != "" {
+		includeDeleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, http.StatusBadRequest, errors.New("include_deleted must be a boolean")
+		}
+		if includeDeleted && !s.isAdmin(r) {
+			return query, http.StatusForbidden, errors.New("include_deleted is only allowed for admins")
+		}
+		query.IncludeDeleted = includeDeleted
+	}
+	return query, 0, nil
+}
+
+// DeleteItem is a handler to soft-delete an item for DELETE /items/{id} . It is only allowed for admins,
+// who are the only ones to see the deleted items.
+func (s *Handlers) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "items are only deleted by admins", http.StatusForbidden)
+		return
+	}
+
+	itemID, err := parseItemID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.itemRepo.Delete(r.Context(), itemID)
+	if err != nil {
+		if errors.Is(err, errItemNotFound) {
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to delete item: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
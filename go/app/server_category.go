@@ -0,0 +1,225 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// findCategory finds the category by ID, or by slug when id is zero.
+// The name of a category is accepted as well, as it is converted into the slug.
+func (s *Handlers) findCategory(ctx context.Context, id int, slugOrName string) (*Category, error) {
+	if id != 0 {
+		return s.categoryRepo.GetByID(ctx, id)
+	}
+	return s.categoryRepo.GetBySlug(ctx, slugify(slugOrName))
+}
+
+// parseCategoryID parses the category ID in the path.
+func parseCategoryID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+// writeCategoryError maps errors from CategoryRepository to HTTP responses.
+func writeCategoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errCategoryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errCategoryExists), errors.Is(err, errCategoryInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errInvalidCategoryName), errors.Is(err, errParentCategoryNotFound), errors.Is(err, errCategoryCycle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("failed to manage category: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type CategoriesResponse struct {
+	Categories []*Category `json:"categories"`
+}
+
+// GetCategories is a handler to list all categories for GET /categories .
+// The tree can be built from parent_id of each category.
+func (s *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := s.categoryRepo.GetAll(r.Context())
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+
+	err = writeJSON(w, r, CategoriesResponse{Categories: categories})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetCategory is a handler to get a category for GET /categories/{id} .
+func (s *Handlers) GetCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := parseCategoryID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	category, err := s.categoryRepo.GetByID(r.Context(), id)
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+
+	err = writeJSON(w, r, category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type AddCategoryRequest struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id,omitempty"`
+}
+
+// AddCategory is a handler to create a category for POST /categories .
+func (s *Handlers) AddCategory(w http.ResponseWriter, r *http.Request) {
+	var req AddCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	category := &Category{Name: req.Name, ParentID: req.ParentID}
+	err := s.categoryRepo.Create(r.Context(), category)
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = writeJSON(w, r, category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type UpdateCategoryRequest struct {
+	Name *string `json:"name,omitempty"`
+	// ParentID moves the category. An explicit null moves it to the root.
+	ParentID optionalInt `json:"parent_id,omitempty"`
+}
+
+// optionalInt distinguishes a JSON field which is absent from one which is null.
+type optionalInt struct {
+	Set   bool
+	Value *int
+}
+
+func (o *optionalInt) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		o.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// UpdateCategory is a handler to rename or move a category for PATCH /categories/{id} .
+func (s *Handlers) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseCategoryID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req UpdateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// the category is read and updated in a single transaction, which SQLite runs one at a time
+	var category *Category
+	err = s.withinTx(ctx, func(ctx context.Context) error {
+		var err error
+		category, err = s.categoryRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if req.Name != nil {
+			category.Name = *req.Name
+		}
+		if req.ParentID.Set {
+			category.ParentID = req.ParentID.Value
+		}
+		return s.categoryRepo.Update(ctx, category)
+	})
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+
+	err = writeJSON(w, r, category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteCategory is a handler to delete a category for DELETE /categories/{id} .
+// Categories which still have items or subcategories can't be deleted.
+func (s *Handlers) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := parseCategoryID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.categoryRepo.Delete(r.Context(), id)
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCategoryItems is a handler to list the items in a category and its descendants for GET /categories/{id}/items .
+// It accepts the same query parameters as GET /items .
+func (s *Handlers) GetCategoryItems(w http.ResponseWriter, r *http.Request) {
+	id, err := parseCategoryID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query, code, err := s.parseItemQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	resp, err := s.itemRepo.GetByCategory(r.Context(), id, query)
+	if err != nil {
+		writeCategoryError(w, err)
+		return
+	}
+	s.setImageURLs(r.Context(), resp.Items...)
+
+	err = writeJSON(w, r, resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
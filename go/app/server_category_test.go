@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestSlugify(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"phone":             "phone",
+		"Smart Phones":      "smart-phones",
+		"  Men's  Fashion ": "men-s-fashion",
+		"ファッション":            "ファッション",
+		"!!!":               "",
+	}
+	for name, want := range cases {
+		if got := slugify(name); got != want {
+			t.Errorf("slugify(%q): want %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestUpdateCategory(t *testing.T) {
+	t.Parallel()
+
+	parentID := 1
+	type wants struct {
+		code     int
+		category *Category
+	}
+	cases := map[string]struct {
+		body     string
+		injector func(m *MockCategoryRepository)
+		wants
+	}{
+		"ok: renamed and the parent is kept": {
+			body: `{"name":"Smart Phones"}`,
+			injector: func(m *MockCategoryRepository) {
+				m.EXPECT().Update(gomock.Any(), &Category{ID: 2, Name: "Smart Phones", Slug: "phone", ParentID: &parentID}).Return(nil)
+			},
+			wants: wants{
+				code:     http.StatusOK,
+				category: &Category{ID: 2, Name: "Smart Phones", Slug: "phone", ParentID: &parentID},
+			},
+		},
+		"ok: null parent moves the category to the root": {
+			body: `{"parent_id":null}`,
+			injector: func(m *MockCategoryRepository) {
+				m.EXPECT().Update(gomock.Any(), &Category{ID: 2, Name: "phone", Slug: "phone"}).Return(nil)
+			},
+			wants: wants{
+				code:     http.StatusOK,
+				category: &Category{ID: 2, Name: "phone", Slug: "phone"},
+			},
+		},
+		"ng: cycle": {
+			body: `{"parent_id":3}`,
+			injector: func(m *MockCategoryRepository) {
+				m.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errCategoryCycle)
+			},
+			wants: wants{code: http.StatusBadRequest},
+		},
+		"ng: duplicated name": {
+			body: `{"name":"PHONE"}`,
+			injector: func(m *MockCategoryRepository) {
+				m.EXPECT().Update(gomock.Any(), gomock.Any()).Return(errCategoryExists)
+			},
+			wants: wants{code: http.StatusConflict},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			mockCR := NewMockCategoryRepository(ctrl)
+			mockCR.EXPECT().GetByID(gomock.Any(), 2).DoAndReturn(func(context.Context, int) (*Category, error) {
+				return &Category{ID: 2, Name: "phone", Slug: "phone", ParentID: &parentID}, nil
+			})
+			tt.injector(mockCR)
+			h := &Handlers{categoryRepo: mockCR}
+
+			req := httptest.NewRequest("PATCH", "/categories/2", strings.NewReader(tt.body))
+			req.SetPathValue("id", "2")
+			rr := httptest.NewRecorder()
+			h.UpdateCategory(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+			if tt.wants.category == nil {
+				return
+			}
+			var got Category
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+			if diff := cmp.Diff(tt.wants.category, &got); diff != "" {
+				t.Errorf("unexpected category (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCategoryRepositoryE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	ctx := context.Background()
+	categoryRepo := &categoryRepository{db: db}
+	itemRepo := &itemRepository{db: db}
+
+	// electronics > phone > smartphone, fashion
+	electronics := createCategory(t, db, "Electronics", nil)
+	phone := createCategory(t, db, "phone", &electronics.ID)
+	smartphone := createCategory(t, db, "Smart Phone", &phone.ID)
+	fashion := createCategory(t, db, "fashion", nil)
+	if smartphone.Slug != "smart-phone" {
+		t.Errorf("unexpected slug: %q", smartphone.Slug)
+	}
+
+	err = categoryRepo.Create(ctx, &Category{Name: "Phone"})
+	if !errors.Is(err, errCategoryExists) {
+		t.Errorf("expected errCategoryExists for a name in different case, got %v", err)
+	}
+	missing := 100
+	err = categoryRepo.Create(ctx, &Category{Name: "tablet", ParentID: &missing})
+	if !errors.Is(err, errParentCategoryNotFound) {
+		t.Errorf("expected errParentCategoryNotFound, got %v", err)
+	}
+	err = categoryRepo.Update(ctx, &Category{ID: electronics.ID, Name: electronics.Name, ParentID: &smartphone.ID})
+	if !errors.Is(err, errCategoryCycle) {
+		t.Errorf("expected errCategoryCycle, got %v", err)
+	}
+
+	for name, categoryID := range map[string]int{"iPhone": smartphone.ID, "landline": phone.ID, "jacket": fashion.ID} {
+		if err := itemRepo.Insert(ctx, &Item{Name: name, CategoryID: categoryID, Image: name + ".jpg"}); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+	err = itemRepo.Insert(ctx, &Item{Name: "unknown", CategoryID: missing, Image: "unknown.jpg"})
+	if !errors.Is(err, errCategoryNotFound) {
+		t.Errorf("expected errCategoryNotFound, got %v", err)
+	}
+
+	items, err := itemRepo.GetByCategory(ctx, electronics.ID, ItemQuery{})
+	if err != nil {
+		t.Fatalf("failed to get items: %v", err)
+	}
+	var names []string
+	for _, item := range items.Items {
+		names = append(names, item.Name)
+	}
+	sort.Strings(names)
+	if diff := cmp.Diff([]string{"iPhone", "landline"}, names); diff != "" {
+		t.Errorf("unexpected items (-want +got):\n%s", diff)
+	}
+
+	err = categoryRepo.Delete(ctx, phone.ID)
+	if !errors.Is(err, errCategoryInUse) {
+		t.Errorf("expected errCategoryInUse, got %v", err)
+	}
+	empty := createCategory(t, db, "empty", &fashion.ID)
+	if err := categoryRepo.Delete(ctx, empty.ID); err != nil {
+		t.Errorf("failed to delete category: %v", err)
+	}
+	_, err = categoryRepo.GetByID(ctx, empty.ID)
+	if !errors.Is(err, errCategoryNotFound) {
+		t.Errorf("expected errCategoryNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+type DBStatsResponse struct {
+	// Pools are the statistics of the connection pools keyed by their roles, e.g. "writer" and "reader".
+	Pools map[string]sql.DBStats `json:"pools"`
+}
+
+// GetDBStats is a handler to return the statistics of the database connection pools for GET /debug/db/stats .
+// It is only allowed for admins.
+func (s *Handlers) GetDBStats(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "debug endpoints are only allowed for admins", http.StatusForbidden)
+		return
+	}
+
+	resp := DBStatsResponse{Pools: map[string]sql.DBStats{}}
+	if s.dbStats != nil {
+		resp.Pools = s.dbStats()
+	}
+	err := writeJSON(w, r, resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
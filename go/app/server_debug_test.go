@@ -0,0 +1,59 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetDBStats(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		token string
+		code  int
+	}{
+		"ok: admin": {
+			token: "Bearer secret",
+			code:  http.StatusOK,
+		},
+		"ng: not an admin": {
+			code: http.StatusForbidden,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := &Handlers{
+				adminToken: "secret",
+				dbStats: func() map[string]sql.DBStats {
+					return map[string]sql.DBStats{"writer": {MaxOpenConnections: 1, InUse: 1}}
+				},
+			}
+			req := httptest.NewRequest("GET", "/debug/db/stats", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			h.GetDBStats(rr, req)
+
+			if tt.code != rr.Code {
+				t.Fatalf("expected status code %d, got %d", tt.code, rr.Code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp DBStatsResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Pools["writer"].MaxOpenConnections != 1 || resp.Pools["writer"].InUse != 1 {
+				t.Errorf("unexpected stats: %+v", resp.Pools)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// The executor of graphql/schema.graphqls is generated into graphql_exec.go and graphql_models.go by gqlgen with gqlgen.yml.
+// The resolvers in graphql_schema.resolvers.go are kept when it is generated again.
+//go:generate sh -c "cd .. && go tool gqlgen generate"
+
+// The limits of the GraphQL operations, which are checked before they are executed.
+const (
+	// graphqlMaxDepth is the maximum nesting of the fields, e.g. 3 for { items { category { name } } }.
+	graphqlMaxDepth = 6
+	// graphqlMaxComplexity is the maximum complexity, where each field costs 1
+	// and the fields of the elements of a list cost graphqlListComplexity times as much.
+	graphqlMaxComplexity = 5000
+	// graphqlListComplexity is the estimated number of the elements of a list.
+	graphqlListComplexity = 50
+	// graphqlCacheSize is the number of the parsed queries and the persisted queries kept in memory.
+	graphqlCacheSize = 1000
+)
+
+// The error codes in the extensions of GraphQL errors, following the ones of gqlgen.
+const (
+	graphqlBadUserInput  = "BAD_USER_INPUT"
+	graphqlForbidden     = "FORBIDDEN"
+	graphqlDepthExceeded = "DEPTH_LIMIT_EXCEEDED"
+)
+
+// GraphQLRequest is the body of POST /graphql , whose fields are the query parameters of GET /graphql as well.
+type GraphQLRequest struct {
+	// Query may be omitted when the persisted query of Extensions was sent before.
+	Query         string         `json:"query,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	// Extensions has the SHA-256 hash of the query in persistedQuery as Automatic Persisted Queries of Apollo.
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLResponse is the response of /graphql .
+type GraphQLResponse struct {
+	Data       any             `json:"data,omitempty"`
+	Errors     []*GraphQLError `json:"errors,omitempty"`
+	Extensions map[string]any  `json:"extensions,omitempty"`
+}
+
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Locations  []any          `json:"locations,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// newGraphQLHandler returns the handler of GET and POST /graphql .
+// Mutations are only accepted with POST.
+func (s *Handlers) newGraphQLHandler() http.HandlerFunc {
+	cfg := Config{Resolvers: &graphqlResolver{h: s}}
+	setListComplexity(&cfg.Complexity)
+
+	srv := handler.New(NewExecutableSchema(cfg))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](graphqlCacheSize))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](graphqlCacheSize)})
+	srv.Use(extension.FixedComplexityLimit(graphqlMaxComplexity))
+	srv.Use(depthLimit{max: graphqlMaxDepth})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.ServeHTTP(w, r.WithContext(withGraphQLLoaders(r.Context(), s)))
+	}
+}
+
+// setListComplexity makes the fields returning lists cost as many times as their elements are estimated to be.
+func setListComplexity(c *ComplexityRoot) {
+	list := func(childComplexity int) int {
+		return 1 + graphqlListComplexity*childComplexity
+	}
+	c.Query.Items = func(childComplexity int, _ *ItemSort, _ *bool) int { return list(childComplexity) }
+	c.Query.SearchItems = func(childComplexity int, _ string) int { return list(childComplexity) }
+	c.Query.Categories = list
+	c.Category.Items = func(childComplexity int, _ *ItemSort) int { return list(childComplexity) }
+	c.Item.Images = list
+}
+
+// depthLimit rejects the operations whose fields are nested deeper than max.
+// The introspection fields aren't counted, as the queries of GraphQL tools are deep by nature.
+type depthLimit struct {
+	max int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = depthLimit{}
+
+func (d depthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d depthLimit) Validate(schema graphql.ExecutableSchema) error {
+	if d.max <= 0 {
+		return errors.New("DepthLimit.max must be positive")
+	}
+	return nil
+}
+
+func (d depthLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	depth := selectionDepth(opCtx.Operation.SelectionSet)
+	if depth <= d.max {
+		return nil
+	}
+	err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.max)
+	errcode.Set(err, graphqlDepthExceeded)
+	return err
+}
+
+// selectionDepth returns the depth of the deepest field of set. Fragments are counted as their fields.
+// The validation of queries has rejected the cycles of fragments before.
+func selectionDepth(set ast.SelectionSet) int {
+	depth := 0
+	for _, sel := range set {
+		var d int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(sel.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			if sel.Definition != nil {
+				d = selectionDepth(sel.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders are the loaders of a request, which batch the lookups of the fields resolved for each element of a list.
+type graphqlLoaders struct {
+	categories *batchLoader[int, *Category]
+	// categoryItems loads the items of Category.items.
+	categoryItems *batchLoader[categoryItemsKey, []*Item]
+}
+
+// categoryItemsKey is the category of Category.items with its sort order.
+type categoryItemsKey struct {
+	categoryID int
+	newest     bool
+}
+
+// withGraphQLLoaders adds new loaders to the context of a request.
+func withGraphQLLoaders(ctx context.Context, s *Handlers) context.Context {
+	return context.WithValue(ctx, graphqlLoadersKey{}, &graphqlLoaders{
+		categories: newBatchLoader(func(ctx context.Context, ids []int) (map[int]*Category, error) {
+			categories, err := s.categoryRepo.GetByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int]*Category, len(categories))
+			for _, category := range categories {
+				byID[category.ID] = category
+			}
+			return byID, nil
+		}),
+		categoryItems: newBatchLoader(func(ctx context.Context, keys []categoryItemsKey) (map[categoryItemsKey][]*Item, error) {
+			// the categories are fetched in one query for each sort order
+			ids := make(map[bool][]int)
+			for _, key := range keys {
+				ids[key.newest] = append(ids[key.newest], key.categoryID)
+			}
+			byKey := make(map[categoryItemsKey][]*Item, len(keys))
+			for newest, categoryIDs := range ids {
+				items, err := s.itemRepo.GetByCategories(ctx, categoryIDs, ItemQuery{Newest: newest})
+				if err != nil {
+					return nil, err
+				}
+				for categoryID, categoryItems := range items {
+					// the URLs are set here, as the cached items are shared by the fields loading the same key
+					s.setImageURLs(ctx, categoryItems...)
+					byKey[categoryItemsKey{categoryID: categoryID, newest: newest}] = categoryItems
+				}
+			}
+			return byKey, nil
+		}),
+	})
+}
+
+// loadersFromContext returns the loaders of the request.
+func loadersFromContext(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// graphqlError returns an error with the code in its extensions.
+func graphqlError(ctx context.Context, code string, err error) error {
+	gqlErr := gqlerror.WrapPath(graphql.GetPath(ctx), err)
+	errcode.Set(gqlErr, code)
+	return gqlErr
+}
+
+// isGraphQLAdmin reports whether the request of the operation has the admin bearer token.
+func (s *Handlers) isGraphQLAdmin(ctx context.Context) bool {
+	return s.isAdminAuthorization(graphql.GetOperationContext(ctx).Headers.Get("Authorization"))
+}
@@ -0,0 +1,360 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// AddItemImagesRequest is the multipart form to add images to an item.
+type AddItemImagesRequest struct {
+	Images [][]byte `form:"image"`
+}
+
+// UploadImageRequest is the multipart form of POST /uploads .
+type UploadImageRequest struct {
+	Image []byte `form:"image"`
+}
+
+// itemQueryParams are the query parameters parsed by parseItemQuery.
+var itemQueryParams = []apiParam{
+	{Name: "sort", Description: "The order of items, by ID or by creation time in descending order.", Schema: &jsonSchema{Type: "string", Enum: []any{"id", "newest"}}},
+	{Name: "include_deleted", Description: "Includes soft-deleted items. Only admins can set it to true.", Schema: &jsonSchema{Type: "boolean"}},
+}
+
+// graphqlQueryParams are the fields of GraphQLRequest sent in the query of GET /graphql .
+// The variables and the extensions are encoded in JSON.
+var graphqlQueryParams = []apiParam{
+	{Name: "query", Description: "The GraphQL document, which may be omitted for a persisted query.", Schema: &jsonSchema{Type: "string"}},
+	{Name: "operationName", Description: "The operation to run when the document has several.", Schema: &jsonSchema{Type: "string"}},
+	{Name: "variables", Description: "The variables encoded in JSON.", Schema: &jsonSchema{Type: "string"}},
+	{Name: "extensions", Description: "The extensions encoded in JSON, e.g. the hash of a persisted query.", Schema: &jsonSchema{Type: "string"}},
+}
+
+// tusResumableHeader is the version of the tus protocol sent with every request of the resumable uploads.
+// It is checked by the handlers, as the protocol answers the other versions with 412 Precondition Failed instead of 400.
+var tusResumableHeader = apiParam{Name: "Tus-Resumable", Description: "The version of the tus protocol, which must be " + tusVersion + ".", Schema: &jsonSchema{Type: "string"}}
+
+// intPtr returns a pointer to n for the optional numbers in schemas.
+func intPtr(n int) *int {
+	return &n
+}
+
+// positiveInt returns the schema of IDs.
+func positiveInt() *jsonSchema {
+	return &jsonSchema{Type: "integer", Minimum: intPtr(1)}
+}
+
+// apiOperations documents the routes registered by registerRoutes keyed by their patterns.
+// Every route must be documented here, which is checked by the tests.
+var apiOperations = map[string]apiOperation{
+	"GET /": {
+		Summary:   "Say hello",
+		Responses: map[int]apiResponse{http.StatusOK: jsonResponse(HelloResponse{})},
+	},
+	"GET /openapi.json": {
+		Summary:   "Get this OpenAPI document",
+		Responses: map[int]apiResponse{http.StatusOK: {MediaType: "application/json"}},
+	},
+	"POST /items": {
+		Summary: "Add an item with images sent in the body or uploaded to POST /uploads beforehand",
+		Request: AddItemRequest{},
+		Form:    AddItemRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                   jsonResponse(AddItemResponse{}),
+			http.StatusBadRequest:           errorResponse,
+			http.StatusUnsupportedMediaType: errorResponse,
+			http.StatusInternalServerError:  errorResponse,
+		},
+	},
+	"GET /items": {
+		Summary: "List items",
+		Admin:   true,
+		Query:   itemQueryParams,
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(ItemsWrapper{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusForbidden:           errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /items/stream": {
+		Summary: "Stream the items added from now on as Server-Sent Events",
+		Headers: []apiParam{
+			{Name: "Last-Event-ID", Description: "The ID of the last event received, after which the stream resumes.", Schema: &jsonSchema{Type: "string"}},
+		},
+		Responses: map[int]apiResponse{
+			http.StatusOK:         {MediaType: "text/event-stream"},
+			http.StatusBadRequest: errorResponse,
+		},
+	},
+	"GET /items/ws": {
+		Summary: "Subscribe to the changes of items or categories over WebSocket. The messages are WSClientMessage and WSServerMessage",
+		Headers: []apiParam{
+			{Name: "Authorization", Description: "The bearer token of the client.", Schema: &jsonSchema{Type: "string"}},
+		},
+		Query: []apiParam{
+			{Name: "access_token", Description: "The bearer token of the client, for browsers which can't set Authorization.", Schema: &jsonSchema{Type: "string"}},
+		},
+		Responses: map[int]apiResponse{
+			http.StatusSwitchingProtocols: {},
+			http.StatusBadRequest:         errorResponse,
+			http.StatusUnauthorized:       errorResponse,
+		},
+	},
+	"GET /images/{filename}": {
+		Summary: "Get an image, or the default image when it isn't found",
+		Responses: map[int]apiResponse{
+			http.StatusOK:          {MediaType: "image/jpeg"},
+			http.StatusNotModified: {},
+			http.StatusBadRequest:  errorResponse,
+		},
+	},
+	"POST /uploads": {
+		Summary: "Upload an image to refer to in POST /items",
+		Form:    UploadImageRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusCreated:             jsonResponse(UploadImageResponse{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"POST /uploads/resumable": {
+		Summary: "Start a resumable upload of an image with the tus protocol. Its URL is returned in Location",
+		Headers: []apiParam{
+			tusResumableHeader,
+			{Name: "Upload-Length", Description: "The size of the image in bytes, which is answered with 413 when it exceeds Tus-Max-Size.", Required: true, Schema: &jsonSchema{Type: "integer", Minimum: intPtr(1)}},
+		},
+		Responses: map[int]apiResponse{
+			http.StatusCreated:               {},
+			http.StatusBadRequest:            errorResponse,
+			http.StatusPreconditionFailed:    errorResponse,
+			http.StatusRequestEntityTooLarge: errorResponse,
+			http.StatusInternalServerError:   errorResponse,
+		},
+	},
+	"HEAD /uploads/resumable/{id}": {
+		Summary: "Get the offset to resume a resumable upload from, and the image ID in Upload-Image-Id once it is complete",
+		Headers: []apiParam{tusResumableHeader},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  {},
+			http.StatusBadRequest:          {},
+			http.StatusNotFound:            {},
+			http.StatusPreconditionFailed:  errorResponse,
+			http.StatusInternalServerError: {},
+		},
+	},
+	"PATCH /uploads/resumable/{id}": {
+		Summary: "Append a chunk to a resumable upload. The uploaded image is returned once it is complete",
+		Headers: []apiParam{
+			tusResumableHeader,
+			{Name: "Upload-Offset", Description: "The offset of the chunk, which must be the current offset of the upload.", Required: true, Schema: &jsonSchema{Type: "integer", Minimum: intPtr(0)}},
+		},
+		RawBody: uploadChunkMediaType,
+		Responses: map[int]apiResponse{
+			http.StatusOK:                    jsonResponse(UploadImageResponse{}),
+			http.StatusNoContent:             {},
+			http.StatusBadRequest:            errorResponse,
+			http.StatusNotFound:              errorResponse,
+			http.StatusConflict:              errorResponse,
+			http.StatusPreconditionFailed:    errorResponse,
+			http.StatusRequestEntityTooLarge: errorResponse,
+			http.StatusUnsupportedMediaType:  errorResponse,
+			http.StatusLocked:                errorResponse,
+			http.StatusInternalServerError:   errorResponse,
+		},
+	},
+	"GET /items/{id}": {
+		Summary:    "Get an item",
+		Admin:      true,
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Query:      itemQueryParams,
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(Item{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusForbidden:           errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"DELETE /items/{id}": {
+		Summary:    "Soft-delete an item",
+		Admin:      true,
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Responses: map[int]apiResponse{
+			http.StatusNoContent:           {},
+			http.StatusBadRequest:          errorResponse,
+			http.StatusForbidden:           errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /items/{id}/similar": {
+		Summary:    "List the items whose cover image looks like the one of an item",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Query: []apiParam{
+			{Name: "threshold", Description: "The maximum Hamming distance between the perceptual hashes.", Schema: &jsonSchema{Type: "integer", Minimum: intPtr(0), Maximum: intPtr(64)}},
+		},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(SimilarItemsResponse{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"POST /items/{id}/images": {
+		Summary:    "Add images to an item",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Form:       AddItemImagesRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(ItemImagesResponse{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"PUT /items/{id}/images/order": {
+		Summary:    "Reorder the images of an item. The first one becomes the cover image",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Request:    ReorderItemImagesRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(ItemImagesResponse{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"DELETE /items/{id}/images/{image_id}": {
+		Summary:    "Delete an image of an item",
+		PathParams: map[string]*jsonSchema{"id": positiveInt(), "image_id": positiveInt()},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(ItemImagesResponse{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /categories": {
+		Summary: "List all categories",
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(CategoriesResponse{}),
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"POST /categories": {
+		Summary: "Create a category",
+		Request: AddCategoryRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusCreated:             jsonResponse(Category{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusConflict:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /categories/{id}": {
+		Summary:    "Get a category",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(Category{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"PATCH /categories/{id}": {
+		Summary:    "Rename or move a category",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Request:    UpdateCategoryRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(Category{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusConflict:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"DELETE /categories/{id}": {
+		Summary:    "Delete a category which has neither items nor subcategories",
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Responses: map[int]apiResponse{
+			http.StatusNoContent:           {},
+			http.StatusBadRequest:          errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusConflict:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /categories/{id}/items": {
+		Summary:    "List the items in a category and its descendants",
+		Admin:      true,
+		PathParams: map[string]*jsonSchema{"id": positiveInt()},
+		Query:      itemQueryParams,
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(ItemsWrapper{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusForbidden:           errorResponse,
+			http.StatusNotFound:            errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /debug/db/stats": {
+		Summary: "Get the statistics of the database connection pools",
+		Admin:   true,
+		Responses: map[int]apiResponse{
+			http.StatusOK:        jsonResponse(DBStatsResponse{}),
+			http.StatusForbidden: errorResponse,
+		},
+	},
+	"POST /webhooks": {
+		Summary: "Register a webhook notified of the events of items. The payloads are WebhookPayload signed like Standard Webhooks with the returned secret",
+		Admin:   true,
+		Request: AddWebhookRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusCreated:             jsonResponse(Webhook{}),
+			http.StatusBadRequest:          errorResponse,
+			http.StatusForbidden:           errorResponse,
+			http.StatusInternalServerError: errorResponse,
+		},
+	},
+	"GET /graphql": {
+		Summary: "Run a GraphQL query, or a persisted query by its hash",
+		Admin:   true,
+		Query:   graphqlQueryParams,
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(GraphQLResponse{}),
+			http.StatusBadRequest:          jsonResponse(GraphQLResponse{}),
+			http.StatusNotAcceptable:       jsonResponse(GraphQLResponse{}),
+			http.StatusUnprocessableEntity: jsonResponse(GraphQLResponse{}),
+		},
+	},
+	"POST /graphql": {
+		Summary: "Run a GraphQL query or mutation, or a persisted one by its hash",
+		Admin:   true,
+		Request: GraphQLRequest{},
+		Responses: map[int]apiResponse{
+			http.StatusOK:                  jsonResponse(GraphQLResponse{}),
+			http.StatusBadRequest:          jsonResponse(GraphQLResponse{}),
+			http.StatusUnprocessableEntity: jsonResponse(GraphQLResponse{}),
+		},
+	},
+}
+
+// openAPIJSON is the document of apiOperations under every version encoded in JSON, which is built on the first request.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	doc, err := buildOpenAPIDocument(apiOperations)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(versionedOpenAPIDocument(doc, apiVersions))
+})
+
+// GetOpenAPI is a handler to return the OpenAPI document of this API for GET /openapi.json .
+func (s *Handlers) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	body, err := openAPIJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
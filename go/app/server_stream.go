@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The defaults of the event streams.
+const (
+	// defaultStreamHeartbeat is the interval of the comments keeping idle streams open through proxies.
+	defaultStreamHeartbeat = 15 * time.Second
+	// streamWriteTimeout bounds each write, so that a client which stopped reading doesn't hold the handler.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry is the reconnection delay suggested to EventSource.
+	streamRetry = 3 * time.Second
+)
+
+// publishItemEvent publishes the event to the streams and the WebSocket clients.
+func (s *Handlers) publishItemEvent(eventType string, item *Item) {
+	s.events.Publish(eventType, item)
+}
+
+// eventItem returns a copy of the item of an event whose image URLs are under the version of ctx.
+func (s *Handlers) eventItem(ctx context.Context, item *Item) *Item {
+	item = cloneItem(item)
+	s.setImageURLs(ctx, item)
+	return item
+}
+
+// StreamItems is a handler to push the items added from now on as Server-Sent Events for GET /items/stream .
+// The ID of each event is resumed from with Last-Event-ID, and the events after it are sent first.
+// The stream is closed when the client falls behind, and it resumes by reconnecting like after a network error.
+func (s *Handlers) StreamItems(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be an ID of an event", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	sub, missed := s.events.Subscribe(lastID)
+	defer s.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		// not every writer supports deadlines, e.g. httptest.ResponseRecorder
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(event ItemEvent) error {
+		// the stream only lists the new items, and the other changes are sent through GET /items/ws
+		if event.Type != itemEventCreated {
+			return nil
+		}
+		data, err := json.Marshal(apiVersionFromContext(r.Context()).encode(s.eventItem(r.Context(), event.Item)))
+		if err != nil {
+			return err
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	}
+
+	if err := write("retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		slog.Debug("failed to start stream", "error", err)
+		return
+	}
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			slog.Debug("failed to send event", "error", err)
+			return
+		}
+	}
+
+	heartbeat := s.streamHeartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.evicted:
+			slog.Info("stream evicted for falling behind", "remote_addr", r.RemoteAddr)
+			return
+		case event := <-sub.events:
+			err = send(event)
+		case <-ticker.C:
+			err = write(": heartbeat\n\n")
+		}
+		if err != nil {
+			slog.Debug("failed to send event", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is a message of an event stream. Comments are kept in Comment.
+type sseMessage struct {
+	ID, Event, Data, Comment string
+}
+
+// openStream opens GET /v1/items/stream and returns a function reading the next message.
+func openStream(t *testing.T, ctx context.Context, srv *httptest.Server, lastEventID string) (*http.Response, func() sseMessage) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/items/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	r := bufio.NewReader(resp.Body)
+	next := func() sseMessage {
+		t.Helper()
+		var msg sseMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return msg
+			}
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "":
+				msg.Comment = value
+			case "id":
+				msg.ID = value
+			case "event":
+				msg.Event = value
+			case "data":
+				msg.Data = value
+			}
+		}
+	}
+	return resp, next
+}
+
+// nextEvent skips the messages other than events, e.g. heartbeats.
+func nextEvent(next func() sseMessage) sseMessage {
+	for {
+		if msg := next(); msg.Event != "" {
+			return msg
+		}
+	}
+}
+
+func TestStreamItems(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	h := &Handlers{
+		imgDirPath:      t.TempDir(),
+		publicBaseURL:   "https://api.example.com",
+		categoryRepo:    categoryRepo,
+		events:          newEventBroker(defaultEventHistory, defaultSubscriberBuffer),
+		streamHeartbeat: 20 * time.Millisecond,
+	}
+	h.itemRepo = &publishingItemRepository{ItemRepository: itemRepo, publish: h.publishItemEvent}
+	srv := httptest.NewServer(newValidatedMux(t, h))
+	t.Cleanup(srv.Close)
+
+	fashion := &Category{Name: "fashion"}
+	if err := categoryRepo.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+	addItem := func(name string) {
+		t.Helper()
+		_, _, err := h.addItem(ctx, &AddItemRequest{Name: name, CategoryID: fashion.ID, Images: [][]byte{[]byte(name + ".jpg")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, next := openStream(t, ctx, srv, "")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected Content-Type %q", ct)
+	}
+	if msg := next(); msg != (sseMessage{}) {
+		t.Errorf("expected the retry message first, got %+v", msg)
+	}
+
+	addItem("jacket")
+	event := nextEvent(next)
+	var item Item
+	if err := json.Unmarshal([]byte(event.Data), &item); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != itemEventCreated || item.Name != "jacket" || item.Category != "fashion" || !strings.HasPrefix(item.ImageURL, "https://api.example.com/v1/images/") {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// idle streams get heartbeats
+	for msg := next(); msg.Comment != "heartbeat"; msg = next() {
+		if msg.Event != "" {
+			t.Fatalf("unexpected event %+v", msg)
+		}
+	}
+
+	// a client reconnecting with the ID of the last event it got receives the events it missed
+	addItem("hat")
+	addItem("scarf")
+	_, resumed := openStream(t, ctx, srv, event.ID)
+	for _, want := range []string{"hat", "scarf"} {
+		event := nextEvent(resumed)
+		if err := json.Unmarshal([]byte(event.Data), &item); err != nil {
+			t.Fatal(err)
+		}
+		if item.Name != want {
+			t.Errorf("expected %s, got %s", want, item.Name)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/items/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "not-an-id")
+	bad, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status code %d for an invalid Last-Event-ID, got %d", http.StatusBadRequest, bad.StatusCode)
+	}
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,9 +13,12 @@ import (
 	"context"
 	"database/sql"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	gomock "go.uber.org/mock/gomock"
 	"mime/multipart"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -28,6 +32,8 @@ func TestParseAddItemRequest(t *testing.T) {
 
 	cases := map[string]struct {
 		args map[string]string
+		// json is sent as the body instead of the multipart form of args when it is set.
+		json string
 		wants
 	}{
 		"ok: valid request": {
@@ -40,11 +46,25 @@ func TestParseAddItemRequest(t *testing.T) {
 				req: &AddItemRequest{
 					Name:     "jacket",
 					Category: "fashion",
-					Image:    []byte("jacket.jpg"),
+					Images:   [][]byte{[]byte("jacket.jpg")},
 				},
 				err: false,
 			},
 		},
+		"ok: uploaded image": {
+			args: map[string]string{
+				"name":        "jacket",
+				"category_id": "1",
+				"image_id":    "uploaded.jpg",
+			},
+			wants: wants{
+				req: &AddItemRequest{
+					Name:       "jacket",
+					CategoryID: 1,
+					ImageIDs:   []string{"uploaded.jpg"},
+				},
+			},
+		},
 		"ng: empty request": {
 			args: map[string]string{},
 			wants: wants{
@@ -52,12 +72,57 @@ func TestParseAddItemRequest(t *testing.T) {
 				err: true,
 			},
 		},
+		"ok: JSON with base64 image": {
+			json: `{"name": "jacket", "category": "fashion", "images": ["amFja2V0LmpwZw=="]}`,
+			wants: wants{
+				req: &AddItemRequest{
+					Name:     "jacket",
+					Category: "fashion",
+					Images:   [][]byte{[]byte("jacket.jpg")},
+				},
+			},
+		},
+		"ok: JSON with uploaded image": {
+			json: `{"name": "jacket", "category_id": 1, "image_ids": ["uploaded.jpg"]}`,
+			wants: wants{
+				req: &AddItemRequest{
+					Name:       "jacket",
+					CategoryID: 1,
+					ImageIDs:   []string{"uploaded.jpg"},
+				},
+			},
+		},
+		"ng: JSON without image": {
+			json:  `{"name": "jacket", "category_id": 1}`,
+			wants: wants{err: true},
+		},
+		"ng: JSON with both images and image IDs": {
+			json:  `{"name": "jacket", "category_id": 1, "images": ["amFja2V0LmpwZw=="], "image_ids": ["uploaded.jpg"]}`,
+			wants: wants{err: true},
+		},
+		"ng: JSON with non-positive category_id": {
+			json:  `{"name": "jacket", "category_id": -1, "images": ["amFja2V0LmpwZw=="]}`,
+			wants: wants{err: true},
+		},
 	}
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
+			if tt.json != "" {
+				req := httptest.NewRequest("POST", "/items", strings.NewReader(tt.json))
+				req.Header.Set("Content-Type", "application/json")
+				got, err := parseAddItemRequest(req)
+				if (err != nil) != tt.err {
+					t.Fatalf("expected error %v, got %v", tt.err, err)
+				}
+				if diff := cmp.Diff(tt.wants.req, got); diff != "" {
+					t.Errorf("unexpected request (-want +got):\n%s", diff)
+				}
+				return
+			}
+
 			var b bytes.Buffer
 			w := multipart.NewWriter(&b)
 
@@ -180,9 +245,12 @@ func TestAddItem(t *testing.T) {
 
 			mockIR := NewMockItemRepository(ctrl)
 			tt.injector(mockIR)
+			mockCR := NewMockCategoryRepository(ctrl)
+			mockCR.EXPECT().GetBySlug(gomock.Any(), "phone").Return(&Category{ID: 1, Name: "phone", Slug: "phone"}, nil)
 			h := &Handlers{
-				imgDirPath: tmpDir,
-				itemRepo:   mockIR,
+				imgDirPath:   tmpDir,
+				itemRepo:     mockIR,
+				categoryRepo: mockCR,
 			}
 
 			var b bytes.Buffer
@@ -234,7 +302,7 @@ func TestAddItemE2e(t *testing.T) {
 		t.Skip("skipping e2e test")
 	}
 
-	db, closers, dbPath, err := setupDB(t)
+	db, closers, _, err := setupDB(t)
 	if err != nil {
 		t.Fatalf("failed to set up database: %v", err)
 	}
@@ -244,6 +312,8 @@ func TestAddItemE2e(t *testing.T) {
 		}
 	})
 
+	createCategory(t, db, "phone", nil)
+
 	type wants struct {
 		code int
 	}
@@ -271,17 +341,24 @@ func TestAddItemE2e(t *testing.T) {
 				code: http.StatusBadRequest,
 			},
 		},
+		"ng: unknown category": {
+			args: map[string]string{
+				"name":     "used iPhone 16e",
+				"category": "smartphone",
+				"image":    "test.jpg",
+			},
+			wants: wants{
+				code: http.StatusBadRequest,
+			},
+		},
 	}
 
 	for name, tt := range cases {
 		t.Run(name, func(t *testing.T) {
 			h := &Handlers{
-				imgDirPath: t.TempDir(),
-				itemRepo: &itemRepository{
-					db:      db,
-					dbPath:  dbPath,
-					sqlPath: "../db/items.sql",
-				},
+				imgDirPath:   t.TempDir(),
+				itemRepo:     &itemRepository{db: db},
+				categoryRepo: &categoryRepository{db: db},
 			}
 
 			var b bytes.Buffer
@@ -346,6 +423,10 @@ func TestAddItemE2e(t *testing.T) {
 				if item.Category != tt.args["category"] {
 					t.Errorf("unexpected category: want %q, got %q", tt.args["category"], item.Category)
 				}
+				wantImage := fmt.Sprintf("%x.jpg", sha256.Sum256([]byte("test image data")))
+				if item.ImageName != wantImage {
+					t.Errorf("unexpected image name: want %q, got %q", wantImage, item.ImageName)
+				}
 			}
 		})
 	}
@@ -367,29 +448,772 @@ func setupDB(t *testing.T) (db *sql.DB, closers []func(), dbPath string, err err
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("failed to create temp file: %w", err)
 	}
-	closers = append(closers, func() {
-		f.Close()
-		os.Remove(f.Name())
-	})
+	f.Close()
 
 	// set up tables
-	db, err = sql.Open("sqlite3", f.Name())
+	db, err = sql.Open(sqliteDriverName, sqliteDSN(f.Name()))
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("failed to open database: %w", err)
 	}
 	closers = append(closers, func() {
 		db.Close()
+		removeSQLiteFiles(f.Name())
 	})
 
-	repo := &itemRepository{
-		db:      db,
-		dbPath:  f.Name(),
-		sqlPath: "../db/items.sql",
-	}
-	err = repo.createTables(context.Background())
+	err = createTables(context.Background(), db, "../db/items.sql")
 	if err != nil {
 		return nil, nil, "", fmt.Errorf("failed to create tables: %w", err)
 	}
 
 	return db, closers, f.Name(), nil
 }
+
+// removeSQLiteFiles removes the SQLite database at dbPath with its WAL files.
+func removeSQLiteFiles(dbPath string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+}
+
+// createCategory creates a category for e2e tests.
+func createCategory(t *testing.T, db *sql.DB, name string, parentID *int) *Category {
+	t.Helper()
+
+	category := &Category{Name: name, ParentID: parentID}
+	if err := (&categoryRepository{db: db}).Create(context.Background(), category); err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+	return category
+}
+
+func TestParseAddItemRequestImages(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		images []string
+		want   [][]byte
+		err    bool
+	}{
+		"ok: images keep the order they were sent in": {
+			images: []string{"front.jpg", "back.jpg", "tag.jpg"},
+			want:   [][]byte{[]byte("front.jpg"), []byte("back.jpg"), []byte("tag.jpg")},
+		},
+		"ng: too many images": {
+			images: strings.Split(strings.Repeat("a.jpg,", maxImagesPerItem+1), ",")[:maxImagesPerItem+1],
+			err:    true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+			w.WriteField("name", "jacket")
+			w.WriteField("category", "fashion")
+			for _, img := range tt.images {
+				fw, err := w.CreateFormFile("image", img)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write([]byte(img))
+			}
+			w.Close()
+
+			req := httptest.NewRequest("POST", "/items", &b)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+
+			got, err := parseAddItemRequest(req)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatal("expected an error, got nil")
+			}
+			if diff := cmp.Diff(tt.want, got.Images); diff != "" {
+				t.Errorf("unexpected images (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReorderItemImages(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		id       string
+		body     string
+		injector func(m *MockItemRepository)
+		wants
+	}{
+		"ok: reordered": {
+			id:   "1",
+			body: `{"image_ids":[2,1]}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().ReorderImages(gomock.Any(), 1, []int{2, 1}).Return([]*ItemImage{
+					{ID: 2, Name: "b.jpg", Position: 0, Cover: true},
+					{ID: 1, Name: "a.jpg", Position: 1},
+				}, nil)
+				// b.jpg isn't stored, so its hash can't be computed
+				m.EXPECT().UpdatePerceptualHash(gomock.Any(), 1, "b.jpg", nil).Return(nil)
+			},
+			wants: wants{code: http.StatusOK},
+		},
+		"ng: invalid id": {
+			id:       "abc",
+			body:     `{"image_ids":[2,1]}`,
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusBadRequest},
+		},
+		"ng: empty order": {
+			id:       "1",
+			body:     `{"image_ids":[]}`,
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusBadRequest},
+		},
+		"ng: item not found": {
+			id:   "1",
+			body: `{"image_ids":[2,1]}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().ReorderImages(gomock.Any(), 1, []int{2, 1}).Return(nil, errItemNotFound)
+			},
+			wants: wants{code: http.StatusNotFound},
+		},
+		"ng: order does not match the images": {
+			id:   "1",
+			body: `{"image_ids":[3]}`,
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().ReorderImages(gomock.Any(), 1, []int{3}).Return(nil, errInvalidImageOrder)
+			},
+			wants: wants{code: http.StatusBadRequest},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR}
+
+			req := httptest.NewRequest("PUT", "/items/"+tt.id+"/images/order", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+			h.ReorderItemImages(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestGetItemsIncludeDeleted(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		query    string
+		token    string
+		injector func(m *MockItemRepository)
+		wants
+	}{
+		"ok: deleted items are excluded by default": {
+			query: "",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetAll(gomock.Any(), ItemQuery{}).Return(&ItemsWrapper{}, nil)
+			},
+			wants: wants{code: http.StatusOK},
+		},
+		"ok: admin includes deleted items": {
+			query: "?include_deleted=true&sort=newest",
+			token: "Bearer secret",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().GetAll(gomock.Any(), ItemQuery{IncludeDeleted: true, Newest: true}).Return(&ItemsWrapper{}, nil)
+			},
+			wants: wants{code: http.StatusOK},
+		},
+		"ng: not an admin": {
+			query:    "?include_deleted=true",
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusForbidden},
+		},
+		"ng: wrong token": {
+			query:    "?include_deleted=true",
+			token:    "Bearer wrong",
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusForbidden},
+		},
+		"ng: invalid sort": {
+			query:    "?sort=price",
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusBadRequest},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR, adminToken: "secret"}
+
+			req := httptest.NewRequest("GET", "/items"+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			h.GetItems(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteItemByAdmin(t *testing.T) {
+	t.Parallel()
+
+	type wants struct {
+		code int
+	}
+	cases := map[string]struct {
+		token    string
+		injector func(m *MockItemRepository)
+		wants
+	}{
+		"ok: deleted by an admin": {
+			token: "Bearer secret",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Delete(gomock.Any(), 1).Return(nil)
+			},
+			wants: wants{code: http.StatusNoContent},
+		},
+		"ng: not an admin": {
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusForbidden},
+		},
+		"ng: wrong token": {
+			token:    "Bearer wrong",
+			injector: func(m *MockItemRepository) {},
+			wants:    wants{code: http.StatusForbidden},
+		},
+		"ng: item not found": {
+			token: "Bearer secret",
+			injector: func(m *MockItemRepository) {
+				m.EXPECT().Delete(gomock.Any(), 1).Return(errItemNotFound)
+			},
+			wants: wants{code: http.StatusNotFound},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			tt.injector(mockIR)
+			h := &Handlers{itemRepo: mockIR, adminToken: "secret"}
+
+			req := httptest.NewRequest("DELETE", "/items/1", nil)
+			req.SetPathValue("id", "1")
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			h.DeleteItem(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteItem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	phone := &Category{Name: "phone"}
+	if err := categoryRepo.Create(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+	item := &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"}
+	if err := itemRepo.Insert(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handlers{itemRepo: itemRepo, categoryRepo: categoryRepo, adminToken: "secret"}
+	id := strconv.Itoa(item.ID)
+
+	// the steps after "delete" see the item it deleted
+	steps := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		admin   bool
+		code    int
+	}{
+		{name: "delete as a non-admin", handler: h.DeleteItem, method: "DELETE", target: "/items/" + id, code: http.StatusForbidden},
+		{name: "get not deleted", handler: h.GetItemByID, method: "GET", target: "/items/" + id, code: http.StatusOK},
+		{name: "delete", handler: h.DeleteItem, method: "DELETE", target: "/items/" + id, admin: true, code: http.StatusNoContent},
+		{name: "delete twice", handler: h.DeleteItem, method: "DELETE", target: "/items/" + id, admin: true, code: http.StatusNotFound},
+		{name: "get deleted", handler: h.GetItemByID, method: "GET", target: "/items/" + id, code: http.StatusNotFound},
+		{name: "get deleted as admin", handler: h.GetItemByID, method: "GET", target: "/items/" + id + "?include_deleted=true", admin: true, code: http.StatusOK},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.target, nil)
+		req.SetPathValue("id", id)
+		if step.admin {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		rr := httptest.NewRecorder()
+		step.handler(rr, req)
+
+		if step.code != rr.Code {
+			t.Errorf("%s: expected status code %d, got %d", step.name, step.code, rr.Code)
+		}
+	}
+}
+
+func TestItemImagesE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	repo := &itemRepository{db: db}
+	ctx := context.Background()
+	fashion := createCategory(t, db, "fashion", nil)
+
+	item := &Item{
+		Name:       "jacket",
+		CategoryID: fashion.ID,
+		Images:     []*ItemImage{{Name: "front.jpg"}, {Name: "back.jpg"}},
+	}
+	if err := repo.Insert(ctx, item); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+
+	images, err := repo.AddImages(ctx, item.ID, []string{"tag.jpg"})
+	if err != nil {
+		t.Fatalf("failed to add images: %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("expected 3 images, got %d", len(images))
+	}
+
+	_, err = repo.ReorderImages(ctx, item.ID, []int{images[2].ID, images[0].ID, images[1].ID})
+	if err != nil {
+		t.Fatalf("failed to reorder images: %v", err)
+	}
+	_, err = repo.DeleteImage(ctx, item.ID, images[0].ID)
+	if err != nil {
+		t.Fatalf("failed to delete image: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, strconv.Itoa(item.ID), ItemQuery{})
+	if err != nil {
+		t.Fatalf("failed to get item: %v", err)
+	}
+	want := &Item{
+		ID:         item.ID,
+		Name:       "jacket",
+		CategoryID: fashion.ID,
+		Category:   "fashion",
+		Image:      "tag.jpg",
+		Images: []*ItemImage{
+			{ID: images[2].ID, Name: "tag.jpg", Position: 0, Cover: true},
+			{ID: images[1].ID, Name: "back.jpg", Position: 1},
+		},
+		CreatedAt: item.CreatedAt,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Item{}, "UpdatedAt")); diff != "" {
+		t.Errorf("unexpected item (-want +got):\n%s", diff)
+	}
+	if !got.UpdatedAt.After(item.UpdatedAt) {
+		t.Errorf("expected updated_at to be updated by image changes, got %v", got.UpdatedAt)
+	}
+
+	_, err = repo.DeleteImage(ctx, item.ID, images[2].ID)
+	if err != nil {
+		t.Fatalf("failed to delete image: %v", err)
+	}
+	_, err = repo.DeleteImage(ctx, item.ID, images[1].ID)
+	if !errors.Is(err, errLastImage) {
+		t.Errorf("expected errLastImage, got %v", err)
+	}
+	_, err = repo.ReorderImages(ctx, item.ID, []int{images[0].ID})
+	if !errors.Is(err, errInvalidImageOrder) {
+		t.Errorf("expected errInvalidImageOrder, got %v", err)
+	}
+}
+
+func TestGetImageCaching(t *testing.T) {
+	t.Parallel()
+
+	imgDir := t.TempDir()
+	h := &Handlers{imgDirPath: imgDir}
+	if err := os.WriteFile(filepath.Join(imgDir, "default.jpg"), []byte("default image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileName, err := h.storeImage([]byte("test image data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"` + strings.TrimSuffix(fileName, ".jpg") + `"`
+
+	type wants struct {
+		code         int
+		etag         string
+		cacheControl string
+	}
+	cases := map[string]struct {
+		fileName    string
+		ifNoneMatch string
+		wants
+	}{
+		"ok: hashed image is immutable": {
+			fileName: fileName,
+			wants: wants{
+				code:         http.StatusOK,
+				etag:         etag,
+				cacheControl: hashedImageCacheControl,
+			},
+		},
+		"ok: matching ETag returns not modified": {
+			fileName:    fileName,
+			ifNoneMatch: etag,
+			wants: wants{
+				code:         http.StatusNotModified,
+				etag:         etag,
+				cacheControl: hashedImageCacheControl,
+			},
+		},
+		"ok: stale ETag returns the image": {
+			fileName:    fileName,
+			ifNoneMatch: `"0000"`,
+			wants: wants{
+				code:         http.StatusOK,
+				etag:         etag,
+				cacheControl: hashedImageCacheControl,
+			},
+		},
+		"ok: default image has a short TTL": {
+			fileName: strings.Repeat("0", 64) + ".jpg",
+			wants: wants{
+				code:         http.StatusOK,
+				cacheControl: fallbackImageCacheControl,
+			},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/images/"+tt.fileName, nil)
+			req.SetPathValue("filename", tt.fileName)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+			h.GetImage(rr, req)
+
+			if tt.wants.code != rr.Code {
+				t.Errorf("expected status code %d, got %d", tt.wants.code, rr.Code)
+			}
+			if got := rr.Header().Get("ETag"); got != tt.wants.etag {
+				t.Errorf("unexpected ETag, want %q, got %q", tt.wants.etag, got)
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.wants.cacheControl {
+				t.Errorf("unexpected Cache-Control, want %q, got %q", tt.wants.cacheControl, got)
+			}
+			if tt.wants.code == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("expected an empty body, got %d bytes", rr.Body.Len())
+			}
+		})
+	}
+}
+
+func TestGetItemByIDImageURLs(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	mockIR := NewMockItemRepository(ctrl)
+	mockIR.EXPECT().GetByID(gomock.Any(), "1", ItemQuery{}).Return(&Item{
+		ID:       1,
+		Name:     "jacket",
+		Category: "fashion",
+		Image:    "a.jpg",
+		Images:   []*ItemImage{{ID: 1, Name: "a.jpg", Cover: true}},
+	}, nil)
+	h := &Handlers{publicBaseURL: "https://api.example.com/", itemRepo: mockIR}
+
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.SetPathValue("id", "1")
+	rr := httptest.NewRecorder()
+	h.GetItemByID(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var got Item
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	want := "https://api.example.com/v1/images/a.jpg"
+	if got.Image != "a.jpg" {
+		t.Errorf("unexpected image, want %q, got %q", "a.jpg", got.Image)
+	}
+	if got.ImageURL != want {
+		t.Errorf("unexpected image_url, want %q, got %q", want, got.ImageURL)
+	}
+	if got.Images[0].URL != want {
+		t.Errorf("unexpected images[0].url, want %q, got %q", want, got.Images[0].URL)
+	}
+}
+
+func TestAddItemNearDuplicateWarning(t *testing.T) {
+	t.Parallel()
+
+	image := encodePNG(t, testImage(t, func(x, y int) uint8 { return uint8(x * 4) }))
+	hash, err := perceptualHash(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		similar     []*SimilarItem
+		wantWarning bool
+		wantIDs     []int
+	}{
+		"ok: near-duplicate exists": {
+			similar:     []*SimilarItem{{Item: &Item{ID: 3}, Distance: 2}},
+			wantWarning: true,
+			wantIDs:     []int{3},
+		},
+		"ok: no near-duplicate": {
+			similar: []*SimilarItem{},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			mockIR := NewMockItemRepository(ctrl)
+			mockIR.EXPECT().FindSimilar(gomock.Any(), hash, defaultSimilarityThreshold).Return(tt.similar, nil)
+			mockCR := NewMockCategoryRepository(ctrl)
+			mockCR.EXPECT().GetBySlug(gomock.Any(), "fashion").Return(&Category{ID: 1, Name: "fashion", Slug: "fashion"}, nil)
+			mockIR.EXPECT().Insert(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, item *Item) error {
+				if item.PerceptualHash == nil || *item.PerceptualHash != hash {
+					t.Errorf("unexpected perceptual hash: %v", item.PerceptualHash)
+				}
+				return nil
+			})
+			h := &Handlers{imgDirPath: t.TempDir(), itemRepo: mockIR, categoryRepo: mockCR}
+
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+			w.WriteField("name", "jacket")
+			w.WriteField("category", "fashion")
+			fw, err := w.CreateFormFile("image", "jacket.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(image)
+			w.Close()
+
+			req := httptest.NewRequest("POST", "/items", &b)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+			rr := httptest.NewRecorder()
+			h.AddItem(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+			var resp AddItemResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response body: %v", err)
+			}
+			if (resp.Warning != "") != tt.wantWarning {
+				t.Errorf("unexpected warning: %q", resp.Warning)
+			}
+			if diff := cmp.Diff(tt.wantIDs, resp.SimilarItemIDs); diff != "" {
+				t.Errorf("unexpected similar item IDs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindSimilarE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	repo := &itemRepository{db: db}
+	ctx := context.Background()
+	fashion := createCategory(t, db, "fashion", nil)
+
+	hashes := map[string]*uint64{}
+	for name, h := range map[string]uint64{"original": 0xF0F0, "edited": 0xF0F1, "other": 0xFFFF_FFFF_0000_0000} {
+		hashes[name] = &h
+	}
+	for _, name := range []string{"original", "edited", "other", "undecodable"} {
+		item := &Item{Name: name, CategoryID: fashion.ID, Image: name + ".jpg", PerceptualHash: hashes[name]}
+		if err := repo.Insert(ctx, item); err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	similar, err := repo.FindSimilar(ctx, 0xF0F0, 3)
+	if err != nil {
+		t.Fatalf("failed to find similar items: %v", err)
+	}
+	var got []string
+	for _, s := range similar {
+		got = append(got, fmt.Sprintf("%s:%d", s.Name, s.Distance))
+		if len(s.Images) != 1 || s.Images[0].Name != s.Name+".jpg" {
+			t.Errorf("%s: expected the images of the item, got %+v", s.Name, s.Images)
+		}
+	}
+	if diff := cmp.Diff([]string{"original:0", "edited:1"}, got); diff != "" {
+		t.Errorf("unexpected similar items (-want +got):\n%s", diff)
+	}
+}
+
+func TestPerceptualHashOfCoverImageE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	db, closers, _, err := setupDB(t)
+	if err != nil {
+		t.Fatalf("failed to set up database: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			c()
+		}
+	})
+	repo := &itemRepository{db: db}
+	h := &Handlers{imgDirPath: t.TempDir(), itemRepo: repo}
+	ctx := context.Background()
+	fashion := createCategory(t, db, "fashion", nil)
+
+	rising := encodePNG(t, testImage(t, func(x, y int) uint8 { return uint8(x * 4) }))
+	falling := encodePNG(t, testImage(t, func(x, y int) uint8 { return uint8(255 - x*4) }))
+	hashes := map[string]uint64{}
+	item := &Item{Name: "jacket", CategoryID: fashion.ID}
+	for _, image := range []struct {
+		name string
+		data []byte
+	}{{"rising", rising}, {"falling", falling}} {
+		hash, err := perceptualHash(image.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[image.name] = hash
+		fileName, err := h.storeImage(image.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.Images = append(item.Images, &ItemImage{Name: fileName})
+	}
+	if hashes["rising"] == hashes["falling"] {
+		t.Fatal("expected the images to have different hashes")
+	}
+	coverHash := hashes["rising"]
+	item.PerceptualHash = &coverHash
+	if err := repo.Insert(ctx, item); err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	id := strconv.Itoa(item.ID)
+	risingID, fallingID := item.Images[0].ID, item.Images[1].ID
+
+	// the image deleted by the second step is the cover set by the first one
+	steps := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		imageID string
+		body    string
+		// cover is the name of the hash of the cover image after the step.
+		cover string
+	}{
+		{name: "reorder", handler: h.ReorderItemImages, method: "PUT", body: fmt.Sprintf(`{"image_ids": [%d, %d]}`, fallingID, risingID), cover: "falling"},
+		{name: "delete the cover", handler: h.DeleteItemImage, method: "DELETE", imageID: strconv.Itoa(fallingID), cover: "rising"},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, "/items/"+id+"/images", strings.NewReader(step.body))
+		req.SetPathValue("id", id)
+		req.SetPathValue("image_id", step.imageID)
+		rr := httptest.NewRecorder()
+		step.handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d: %s", step.name, http.StatusOK, rr.Code, rr.Body)
+		}
+
+		got, err := repo.GetByID(ctx, id, ItemQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PerceptualHash == nil || *got.PerceptualHash != hashes[step.cover] {
+			t.Errorf("%s: expected the hash of the %s image, got %v", step.name, step.cover, got.PerceptualHash)
+		}
+		similar, err := repo.FindSimilar(ctx, hashes[step.cover], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(similar) != 1 || similar[0].ID != item.ID {
+			t.Errorf("%s: expected the item to be similar to its cover image, got %+v", step.name, similar)
+		}
+	}
+
+	// the hash isn't written once the cover has been replaced
+	if err := repo.UpdatePerceptualHash(ctx, item.ID, "replaced.jpg", nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(ctx, id, ItemQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PerceptualHash == nil || *got.PerceptualHash != hashes["rising"] {
+		t.Errorf("expected the hash of the cover image to be kept, got %v", got.PerceptualHash)
+	}
+}
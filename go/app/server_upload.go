@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The resumable uploads follow the core protocol and the creation extension of tus 1.0.0 (https://tus.io/protocols/resumable-upload).
+// A client creates an upload with its length, sends the chunks with PATCH and asks for the offset with HEAD to resume.
+// The complete upload is stored as an image, whose ID can be referred to in POST /items like the ones of POST /uploads .
+
+// tusVersion is the version of the tus protocol of the resumable uploads.
+const tusVersion = "1.0.0"
+
+// uploadChunkMediaType is the media type of the chunks of resumable uploads.
+const uploadChunkMediaType = "application/offset+octet-stream"
+
+// checkTusResumable rejects the requests of other tus versions with 412 Precondition Failed.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Tus-Resumable must be "+tusVersion, http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadHeader parses a header of a non-negative size, e.g. Upload-Length.
+func parseUploadHeader(r *http.Request, name string) (int64, error) {
+	n, err := strconv.ParseInt(r.Header.Get(name), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// uploadURL builds the absolute URL of a resumable upload under the version of the request.
+func (s *Handlers) uploadURL(ctx context.Context, id string) string {
+	return strings.TrimSuffix(s.publicBaseURL, "/") + "/" + apiVersionFromContext(ctx).Name + "/uploads/resumable/" + id
+}
+
+// CreateUpload is a handler to start a resumable upload for POST /uploads/resumable .
+// The URL of the upload is returned in Location.
+func (s *Handlers) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	length, err := parseUploadHeader(r, "Upload-Length")
+	if err != nil || length == 0 {
+		http.Error(w, "Upload-Length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if length > maxUploadLength {
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(maxUploadLength))
+		http.Error(w, "Upload-Length exceeds the maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	id, err := s.uploads.create(length)
+	if err != nil {
+		slog.Error("failed to create upload: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", s.uploadURL(r.Context(), id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUploadOffset is a handler to return the progress of a resumable upload for HEAD /uploads/resumable/{id} .
+// Once the upload is complete, its image ID is returned in Upload-Image-Id as well.
+func (s *Handlers) GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	st, err := s.uploads.status(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, errUploadNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get upload: ", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(st.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(st.Length, 10))
+	if st.ImageID != "" {
+		w.Header().Set("Upload-Image-Id", st.ImageID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload is a handler to append a chunk to a resumable upload for PATCH /uploads/resumable/{id} .
+// It returns 204 No Content until the upload is complete, and the uploaded image like POST /uploads after that.
+func (s *Handlers) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != uploadChunkMediaType {
+		http.Error(w, "Content-Type must be "+uploadChunkMediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := parseUploadHeader(r, "Upload-Offset")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	st, err := s.uploads.append(r.PathValue("id"), offset, r.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUploadNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errUploadOffsetMismatch):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, errUploadTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, errUploadLocked):
+			http.Error(w, err.Error(), http.StatusLocked)
+		default:
+			// the client resumes from the offset it gets with HEAD
+			slog.Error("failed to write chunk: ", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(st.Offset, 10))
+	if st.ImageID == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	err = writeJSON(w, r, UploadImageResponse{ImageID: st.ImageID, URL: s.imageURL(r.Context(), st.ImageID)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
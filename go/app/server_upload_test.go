@@ -0,0 +1,218 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newUploadHandlers returns the handlers with a resumable upload store in a temporary image directory.
+func newUploadHandlers(t *testing.T) *Handlers {
+	t.Helper()
+
+	h := &Handlers{imgDirPath: t.TempDir(), publicBaseURL: "https://api.example.com"}
+	var err error
+	h.uploads, err = newUploadStore(filepath.Join(h.imgDirPath, ".uploads"), h.storeImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestResumableUpload(t *testing.T) {
+	t.Parallel()
+
+	h := newUploadHandlers(t)
+	mux := newValidatedMux(t, h)
+	image := "a resumable image"
+
+	send := func(method, target string, header map[string]string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("POST", "/uploads/resumable", map[string]string{"Upload-Length": fmt.Sprint(len(image))}, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	location, found := strings.CutPrefix(rr.Header().Get("Location"), "https://api.example.com")
+	if !found {
+		t.Fatalf("unexpected Location: %q", rr.Header().Get("Location"))
+	}
+
+	// each step continues the upload from the offset which the earlier chunks reached
+	chunk := func(offset int) map[string]string {
+		return map[string]string{"Content-Type": uploadChunkMediaType, "Upload-Offset": fmt.Sprint(offset)}
+	}
+	steps := []struct {
+		name   string
+		method string
+		header map[string]string
+		body   string
+		code   int
+		// offset is the Upload-Offset returned by the step.
+		offset string
+	}{
+		{name: "no chunk yet", method: "HEAD", code: http.StatusOK, offset: "0"},
+		{name: "first chunk", method: "PATCH", header: chunk(0), body: image[:5], code: http.StatusNoContent, offset: "5"},
+		{name: "resent chunk", method: "PATCH", header: chunk(0), body: image[:5], code: http.StatusConflict},
+		{name: "chunk beyond the length", method: "PATCH", header: chunk(5), body: image[5:] + "!", code: http.StatusRequestEntityTooLarge},
+		{name: "resume", method: "HEAD", code: http.StatusOK, offset: "5"},
+		{name: "wrong content type", method: "PATCH", header: map[string]string{"Upload-Offset": "5"}, body: image[5:], code: http.StatusUnsupportedMediaType},
+		{name: "last chunk", method: "PATCH", header: chunk(5), body: image[5:], code: http.StatusOK, offset: fmt.Sprint(len(image))},
+		{name: "complete", method: "HEAD", code: http.StatusOK, offset: fmt.Sprint(len(image))},
+		{name: "chunk after completion", method: "PATCH", header: chunk(len(image)), code: http.StatusConflict},
+	}
+	imageID := fmt.Sprintf("%x.jpg", sha256.Sum256([]byte(image)))
+	for _, step := range steps {
+		rr := send(step.method, location, step.header, step.body)
+		if rr.Code != step.code {
+			t.Fatalf("%s: expected status code %d, got %d: %s", step.name, step.code, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("Upload-Offset"); step.offset != "" && got != step.offset {
+			t.Errorf("%s: expected Upload-Offset %s, got %q", step.name, step.offset, got)
+		}
+		if step.name == "complete" && rr.Header().Get("Upload-Image-Id") != imageID {
+			t.Errorf("%s: expected Upload-Image-Id %s, got %q", step.name, imageID, rr.Header().Get("Upload-Image-Id"))
+		}
+		if rr.Code != http.StatusOK || step.method != "PATCH" {
+			continue
+		}
+		// the complete upload is stored like POST /uploads
+		var resp UploadImageResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		want := UploadImageResponse{ImageID: imageID, URL: "https://api.example.com/v1/images/" + imageID}
+		if diff := cmp.Diff(want, resp); diff != "" {
+			t.Errorf("unexpected response (-want +got):\n%s", diff)
+		}
+		stored, err := os.ReadFile(filepath.Join(h.imgDirPath, imageID))
+		if err != nil || string(stored) != image {
+			t.Errorf("expected the image to be stored, got %q: %v", stored, err)
+		}
+	}
+}
+
+func TestResumableUploadRejected(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		method string
+		target string
+		header map[string]string
+		code   int
+	}{
+		"ng: another tus version": {
+			method: "POST",
+			target: "/uploads/resumable",
+			header: map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "10"},
+			code:   http.StatusPreconditionFailed,
+		},
+		"ng: no length": {
+			method: "POST",
+			target: "/uploads/resumable",
+			header: map[string]string{"Tus-Resumable": tusVersion},
+			code:   http.StatusBadRequest,
+		},
+		"ng: too large": {
+			method: "POST",
+			target: "/uploads/resumable",
+			header: map[string]string{"Tus-Resumable": tusVersion, "Upload-Length": fmt.Sprint(maxUploadLength + 1)},
+			code:   http.StatusRequestEntityTooLarge,
+		},
+		"ng: unknown upload": {
+			method: "HEAD",
+			target: "/uploads/resumable/00000000000000000000000000000000",
+			header: map[string]string{"Tus-Resumable": tusVersion},
+			code:   http.StatusNotFound,
+		},
+		"ng: invalid upload ID": {
+			method: "PATCH",
+			target: "/uploads/resumable/not-an-id",
+			header: map[string]string{"Tus-Resumable": tusVersion, "Content-Type": uploadChunkMediaType, "Upload-Offset": "0"},
+			code:   http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mux := newValidatedMux(t, newUploadHandlers(t))
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.code {
+				t.Errorf("expected status code %d, got %d: %s", tt.code, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadStoreCleanup(t *testing.T) {
+	t.Parallel()
+
+	u := newUploadHandlers(t).uploads
+	expired, err := u.create(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := u.create(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the expired upload received its last chunk two days ago
+	if _, err := u.append(expired, 0, strings.NewReader("12345")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{u.partPath(expired), u.infoPath(expired)} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := u.cleanup(DefaultUploadTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{expired}, removed); diff != "" {
+		t.Errorf("unexpected removed uploads (-want +got):\n%s", diff)
+	}
+	if _, err := u.status(expired); err != errUploadNotFound {
+		t.Errorf("expected the expired upload to be removed, got %v", err)
+	}
+	if _, err := u.status(active); err != nil {
+		t.Errorf("expected the active upload to be kept, got %v", err)
+	}
+	entries, _ := os.ReadDir(u.dirPath)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{active + ".json", active + ".part"}; !slices.Equal(want, names) {
+		t.Errorf("expected files %v, got %v", want, names)
+	}
+}
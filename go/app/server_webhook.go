@@ -0,0 +1,67 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+type AddWebhookRequest struct {
+	// URL is the http or https URL which the payloads are POSTed to.
+	URL string `json:"url"`
+	// EventTypes are the types of the events sent to the webhook, which are item.created, item.updated and item.deleted.
+	EventTypes []string `json:"event_types"`
+}
+
+// AddWebhook is a handler to register a webhook for POST /webhooks . It is only allowed for admins.
+// The secret of the signatures is generated by the server, and it is only returned in this response.
+func (s *Handlers) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		http.Error(w, "webhooks are only registered by admins", http.StatusForbidden)
+		return
+	}
+
+	var req AddWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		http.Error(w, "event_types is required", http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			http.Error(w, fmt.Sprintf("unknown event type %q, which must be one of %s", eventType, strings.Join(webhookEventTypes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhook := &Webhook{
+		URL:        req.URL,
+		EventTypes: slices.Compact(slices.Sorted(slices.Values(req.EventTypes))),
+		Secret:     newWebhookSecret(),
+	}
+	err = s.webhookRepo.Create(r.Context(), webhook)
+	if err != nil {
+		slog.Error("failed to register webhook: ", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = writeJSON(w, r, webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
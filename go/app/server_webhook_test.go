@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddWebhook(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		token      string
+		body       string
+		code       int
+		eventTypes []string
+	}{
+		"ok: admin": {
+			token:      "Bearer secret",
+			body:       `{"url": "https://partner.example.com/hooks", "event_types": ["item.deleted", "item.created", "item.deleted"]}`,
+			code:       http.StatusCreated,
+			eventTypes: []string{"item.created", "item.deleted"},
+		},
+		"ng: not an admin": {
+			body: `{"url": "https://partner.example.com/hooks", "event_types": ["item.created"]}`,
+			code: http.StatusForbidden,
+		},
+		"ng: relative URL": {
+			token: "Bearer secret",
+			body:  `{"url": "/hooks", "event_types": ["item.created"]}`,
+			code:  http.StatusBadRequest,
+		},
+		"ng: not http": {
+			token: "Bearer secret",
+			body:  `{"url": "ftp://partner.example.com/hooks", "event_types": ["item.created"]}`,
+			code:  http.StatusBadRequest,
+		},
+		"ng: no event type": {
+			token: "Bearer secret",
+			body:  `{"url": "https://partner.example.com/hooks", "event_types": []}`,
+			code:  http.StatusBadRequest,
+		},
+		"ng: unknown event type": {
+			token: "Bearer secret",
+			body:  `{"url": "https://partner.example.com/hooks", "event_types": ["item.sold"]}`,
+			code:  http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := &Handlers{adminToken: "secret", webhookRepo: NewMemoryWebhookRepository()}
+			req := httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			newValidatedMux(t, h).ServeHTTP(rr, req)
+
+			if tt.code != rr.Code {
+				t.Fatalf("expected status code %d, got %d: %s", tt.code, rr.Code, rr.Body)
+			}
+			if tt.code != http.StatusCreated {
+				return
+			}
+			var webhook Webhook
+			if err := json.NewDecoder(rr.Body).Decode(&webhook); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.eventTypes, webhook.EventTypes); diff != "" {
+				t.Errorf("unexpected event types (-want +got):\n%s", diff)
+			}
+			if webhook.ID == 0 || !strings.HasPrefix(webhook.Secret, webhookSecretPrefix) {
+				t.Errorf("unexpected webhook %+v", webhook)
+			}
+		})
+	}
+}
+
+func TestWebhooksOfAddedItems(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	h := &Handlers{
+		imgDirPath:    t.TempDir(),
+		publicBaseURL: "https://api.example.com",
+		adminToken:    "secret",
+		categoryRepo:  categoryRepo,
+		webhookRepo:   NewMemoryWebhookRepository(),
+		txManager:     memoryTxManager{},
+	}
+	h.itemRepo = &outboxItemRepository{ItemRepository: itemRepo, tx: h.txManager, enqueue: h.enqueueWebhookEvent}
+	mux := newValidatedMux(t, h)
+	fashion := &Category{Name: "fashion"}
+	if err := categoryRepo.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+
+	// the secret returned by the registration verifies the signatures
+	rcv := newWebhookReceiver(t, "")
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhooks", strings.NewReader(`{"url": "`+rcv.URL+`", "event_types": ["item.created"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var webhook Webhook
+	if err := json.NewDecoder(rr.Body).Decode(&webhook); err != nil {
+		t.Fatal(err)
+	}
+	rcv.mu.Lock()
+	rcv.secret = webhook.Secret
+	rcv.mu.Unlock()
+
+	if _, _, err := h.addItem(ctx, &AddItemRequest{Name: "jacket", CategoryID: fashion.ID, Images: [][]byte{[]byte("jacket.jpg")}}); err != nil {
+		t.Fatal(err)
+	}
+	w := &WebhookWorker{Repo: h.webhookRepo, Client: rcv.Client(), MaxAttempts: 1, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, BatchSize: 10}
+	runWebhookWorker(t, w, webhook.ID)
+
+	payloads, _ := rcv.received()
+	if len(payloads) != 1 {
+		t.Fatalf("expected a payload, got %+v", payloads)
+	}
+	if p := payloads[0]; p.Type != itemEventCreated || p.Item.Name != "jacket" || p.Item.Category != "fashion" || !strings.HasPrefix(p.Item.ImageURL, "https://api.example.com/v1/images/") {
+		t.Errorf("unexpected payload %+v", p)
+	}
+}
@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// The limits of the WebSocket clients.
+const (
+	// wsMaxMessageBytes is the size of the largest message accepted from a client.
+	wsMaxMessageBytes = 64 << 10
+	// wsMaxSubscriptions is the number of the item IDs and the category IDs a client may subscribe to at once.
+	wsMaxSubscriptions = 100
+)
+
+// The types of WSClientMessage.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// The types of WSServerMessage.
+const (
+	wsSubscribed = "subscribed"
+	wsEvent      = "event"
+	wsError      = "error"
+)
+
+// WSClientMessage is a message sent by the clients of GET /items/ws .
+type WSClientMessage struct {
+	// Type is "subscribe" or "unsubscribe".
+	Type    string `json:"type"`
+	ItemIDs []int  `json:"item_ids"`
+	// CategoryIDs subscribe to the items of the categories and all of their descendants.
+	CategoryIDs []int `json:"category_ids"`
+	// LastEventID is the ID of the last event received before reconnecting.
+	// The events after it which match the new subscriptions are sent first.
+	LastEventID uint64 `json:"last_event_id,omitempty"`
+}
+
+// WSServerMessage is a message sent to the clients of GET /items/ws .
+type WSServerMessage struct {
+	// Type is "subscribed" after a change of the subscriptions, "event" for a change of an item, or "error".
+	Type string `json:"type"`
+	// ID is the ID of the event, which is resumed from with LastEventID.
+	ID uint64 `json:"id,omitempty"`
+	// Event is the type of the event, e.g. "item.deleted".
+	Event string `json:"event,omitempty"`
+	// Item is the item after the change.
+	Item any `json:"item,omitempty"`
+	// ItemIDs and CategoryIDs are the subscriptions after the change.
+	ItemIDs     []int  `json:"item_ids,omitempty"`
+	CategoryIDs []int  `json:"category_ids,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// wsCommand is a message read from a client, or the error which made it unreadable.
+type wsCommand struct {
+	msg WSClientMessage
+	err error
+}
+
+// wsSubscriptions are the items a client subscribed to.
+type wsSubscriptions struct {
+	items      map[int]struct{}
+	categories map[int]struct{}
+	// scope is the categories and all of their descendants.
+	scope map[int]struct{}
+}
+
+// matches reports whether the event is of a subscribed item.
+func (w *wsSubscriptions) matches(event ItemEvent) bool {
+	if _, ok := w.items[event.Item.ID]; ok {
+		return true
+	}
+	_, ok := w.scope[event.Item.CategoryID]
+	return ok
+}
+
+// ItemsWebSocket is a handler to push the changes of the subscribed items over WebSocket for GET /items/ws .
+// The clients are authenticated before the upgrade by a bearer token in Authorization, or in access_token for browsers.
+// The connection is closed when the client falls behind, and it resumes by subscribing with the ID of the last event it got.
+func (s *Handlers) ItemsWebSocket(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = r.URL.Query().Get("access_token")
+	}
+	if !s.isClientToken(token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "a valid token is required", http.StatusUnauthorized)
+		return
+	}
+
+	// the origin isn't checked, as the clients are authenticated by tokens instead of cookies
+	websocket.Server{Handler: s.serveItemsWebSocket}.ServeHTTP(w, r)
+}
+
+// isClientToken reports whether token is one of the client tokens or the admin token.
+func (s *Handlers) isClientToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	valid := false
+	for _, t := range append([]string{s.adminToken}, s.clientTokens...) {
+		// every token is compared, so that the time doesn't tell which one is close
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// serveItemsWebSocket sends the events of the subscribed items until the client leaves or falls behind.
+// The messages of the client are read in another goroutine, which waits for each of them to be handled,
+// so that a client sending faster than it is answered is held back by TCP.
+func (s *Handlers) serveItemsWebSocket(ws *websocket.Conn) {
+	ctx := ws.Request().Context()
+	ws.MaxPayloadBytes = wsMaxMessageBytes
+	// Write sends pings, and the messages are sent by websocket.JSON
+	ws.PayloadType = websocket.PingFrame
+	defer ws.Close()
+
+	sub, _ := s.events.Subscribe(0)
+	defer s.events.Unsubscribe(sub)
+
+	done := make(chan struct{})
+	defer close(done)
+	commands := make(chan wsCommand)
+	go func() {
+		defer close(commands)
+		for {
+			var msg WSClientMessage
+			err := websocket.JSON.Receive(ws, &msg)
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if err != nil && !errors.Is(err, websocket.ErrFrameTooLarge) && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				slog.Debug("websocket closed", "error", err)
+				return
+			}
+			select {
+			case commands <- wsCommand{msg: msg, err: err}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	version := apiVersionFromContext(ctx)
+	send := func(msg WSServerMessage) error {
+		if err := ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		return websocket.JSON.Send(ws, msg)
+	}
+	sendEvent := func(event ItemEvent) error {
+		return send(WSServerMessage{Type: wsEvent, ID: event.ID, Event: event.Type, Item: version.encode(s.eventItem(ctx, event.Item))})
+	}
+
+	subs := &wsSubscriptions{items: map[int]struct{}{}, categories: map[int]struct{}{}, scope: map[int]struct{}{}}
+	// seen is the ID of the last event taken from sub, whose events up to it were sent if they matched
+	seen := sub.startID
+
+	heartbeat := s.streamHeartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.evicted:
+			slog.Info("websocket evicted for falling behind", "remote_addr", ws.Request().RemoteAddr)
+			_ = send(WSServerMessage{Type: wsError, Message: "fell behind the events; resubscribe with the ID of the last event received"})
+			return
+		case cmd, ok := <-commands:
+			if !ok {
+				return
+			}
+			err = s.handleWebSocketCommand(ctx, cmd, subs, seen, send, sendEvent)
+		case event := <-sub.events:
+			seen = event.ID
+			if subs.matches(event) {
+				err = sendEvent(event)
+			}
+		case <-ticker.C:
+			if err = ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err == nil {
+				_, err = ws.Write(nil)
+			}
+		}
+		if err != nil {
+			slog.Debug("failed to send websocket message", "error", err)
+			return
+		}
+	}
+}
+
+// handleWebSocketCommand changes the subscriptions by a message of a client and answers it.
+// When the client resumes, the events between LastEventID and seen which only match the new subscriptions are sent,
+// as the ones after seen are sent as they are taken from the subscription.
+func (s *Handlers) handleWebSocketCommand(ctx context.Context, cmd wsCommand, subs *wsSubscriptions, seen uint64,
+	send func(WSServerMessage) error, sendEvent func(ItemEvent) error) error {
+	if cmd.err != nil {
+		return send(WSServerMessage{Type: wsError, Message: fmt.Sprintf("invalid message: %v", cmd.err)})
+	}
+	msg := cmd.msg
+
+	next := &wsSubscriptions{items: maps.Clone(subs.items), categories: maps.Clone(subs.categories)}
+	switch msg.Type {
+	case wsSubscribe:
+		for _, id := range msg.ItemIDs {
+			next.items[id] = struct{}{}
+		}
+		for _, id := range msg.CategoryIDs {
+			next.categories[id] = struct{}{}
+		}
+	case wsUnsubscribe:
+		for _, id := range msg.ItemIDs {
+			delete(next.items, id)
+		}
+		for _, id := range msg.CategoryIDs {
+			delete(next.categories, id)
+		}
+	default:
+		return send(WSServerMessage{Type: wsError, Message: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+	if len(next.items)+len(next.categories) > wsMaxSubscriptions {
+		return send(WSServerMessage{Type: wsError, Message: fmt.Sprintf("up to %d items and categories can be subscribed to", wsMaxSubscriptions)})
+	}
+
+	categories, err := s.categoryRepo.GetAll(ctx)
+	if err != nil {
+		slog.Error("failed to get categories: ", "error", err)
+		return send(WSServerMessage{Type: wsError, Message: "failed to get categories"})
+	}
+	next.scope, err = categoryScope(categories, next.categories)
+	if err != nil {
+		return send(WSServerMessage{Type: wsError, Message: err.Error()})
+	}
+
+	var missed []ItemEvent
+	if msg.Type == wsSubscribe && msg.LastEventID != 0 {
+		for _, event := range s.events.History(msg.LastEventID) {
+			if event.ID <= seen && next.matches(event) && !subs.matches(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	*subs = *next
+
+	if err := send(WSServerMessage{Type: wsSubscribed, ItemIDs: slices.Sorted(maps.Keys(subs.items)), CategoryIDs: slices.Sorted(maps.Keys(subs.categories))}); err != nil {
+		return err
+	}
+	for _, event := range missed {
+		if err := sendEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryScope returns the IDs of roots and all of their descendants in categories.
+func categoryScope(categories []*Category, roots map[int]struct{}) (map[int]struct{}, error) {
+	children := make(map[int][]int)
+	exists := make(map[int]bool, len(categories))
+	for _, c := range categories {
+		exists[c.ID] = true
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+
+	scope := make(map[int]struct{})
+	for id := range roots {
+		if !exists[id] {
+			return nil, fmt.Errorf("category %d is not found", id)
+		}
+		queue := []int{id}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if _, ok := scope[id]; ok {
+				continue
+			}
+			scope[id] = struct{}{}
+			queue = append(queue, children[id]...)
+		}
+	}
+	return scope, nil
+}
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/websocket"
+)
+
+// blockingCategoryRepository holds GetAll until release is closed, to keep a WebSocket handler busy.
+type blockingCategoryRepository struct {
+	CategoryRepository
+	// called is sent to when GetAll starts blocking.
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingCategoryRepository) GetAll(ctx context.Context) ([]*Category, error) {
+	b.called <- struct{}{}
+	<-b.release
+	return b.CategoryRepository.GetAll(ctx)
+}
+
+// wsEventMessage is WSServerMessage with the item decoded.
+type wsEventMessage struct {
+	WSServerMessage
+	Item *Item `json:"item"`
+}
+
+// dialItemsWebSocket connects to GET /v1/items/ws with token and returns a function receiving the next message.
+func dialItemsWebSocket(t *testing.T, srv *httptest.Server, token string) (*websocket.Conn, func() wsEventMessage) {
+	t.Helper()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/items/ws", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header.Set("Authorization", "Bearer "+token)
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	receive := func() wsEventMessage {
+		t.Helper()
+		if err := ws.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		var msg wsEventMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("failed to receive message: %v", err)
+		}
+		return msg
+	}
+	return ws, receive
+}
+
+// sendWebSocket sends msg, which is a WSClientMessage or a raw text.
+func sendWebSocket(t *testing.T, ws *websocket.Conn, msg any) {
+	t.Helper()
+
+	var err error
+	if text, ok := msg.(string); ok {
+		err = websocket.Message.Send(ws, text)
+	} else {
+		err = websocket.JSON.Send(ws, msg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestItemsWebSocket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	h := &Handlers{
+		imgDirPath:      t.TempDir(),
+		publicBaseURL:   "https://api.example.com",
+		adminToken:      "secret",
+		clientTokens:    []string{"app-token"},
+		categoryRepo:    categoryRepo,
+		events:          newEventBroker(defaultEventHistory, defaultSubscriberBuffer),
+		streamHeartbeat: 20 * time.Millisecond,
+	}
+	h.itemRepo = &publishingItemRepository{ItemRepository: itemRepo, publish: h.publishItemEvent}
+	srv := httptest.NewServer(newValidatedMux(t, h))
+	t.Cleanup(srv.Close)
+
+	fashion := &Category{Name: "fashion"}
+	if err := categoryRepo.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+	jackets := &Category{Name: "jackets", ParentID: &fashion.ID}
+	if err := categoryRepo.Create(ctx, jackets); err != nil {
+		t.Fatal(err)
+	}
+	books := &Category{Name: "books"}
+	if err := categoryRepo.Create(ctx, books); err != nil {
+		t.Fatal(err)
+	}
+	addItem := func(name string, categoryID int) *Item {
+		t.Helper()
+		item := &Item{Name: name, CategoryID: categoryID, Image: name + ".jpg"}
+		if err := h.itemRepo.Insert(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+		return item
+	}
+	book := addItem("book", books.ID)
+
+	t.Run("authenticates before the upgrade", func(t *testing.T) {
+		cases := map[string]struct {
+			header http.Header
+			query  string
+			want   int
+		}{
+			"ng: no token": {
+				want: http.StatusUnauthorized,
+			},
+			"ng: unknown token": {
+				header: http.Header{"Authorization": {"Bearer unknown"}},
+				want:   http.StatusUnauthorized,
+			},
+			"ok: client token, but not a WebSocket handshake": {
+				header: http.Header{"Authorization": {"Bearer app-token"}},
+				want:   http.StatusBadRequest,
+			},
+			"ok: admin token in the query": {
+				query: "?access_token=secret",
+				want:  http.StatusBadRequest,
+			},
+		}
+		for name, tt := range cases {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/items/ws"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = tt.header
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s: expected status code %d, got %d", name, tt.want, resp.StatusCode)
+			}
+		}
+	})
+
+	ws, receive := dialItemsWebSocket(t, srv, "app-token")
+	sendWebSocket(t, ws, WSClientMessage{Type: wsSubscribe, CategoryIDs: []int{fashion.ID}})
+	if msg := receive(); msg.Type != wsSubscribed || !cmp.Equal(msg.CategoryIDs, []int{fashion.ID}) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	// the items of the descendants of the subscribed categories are sent, and the others aren't
+	coat := addItem("coat", jackets.ID)
+	created := receive()
+	if created.Type != wsEvent || created.Event != itemEventCreated || created.Item.Name != "coat" || created.Item.ImageURL != "https://api.example.com/v1/images/coat.jpg" {
+		t.Errorf("unexpected message %+v", created)
+	}
+	novel := addItem("novel", books.ID)
+
+	sendWebSocket(t, ws, WSClientMessage{Type: wsSubscribe, ItemIDs: []int{book.ID}})
+	if msg := receive(); msg.Type != wsSubscribed || !cmp.Equal(msg.ItemIDs, []int{book.ID}) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if err := h.itemRepo.Delete(ctx, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg.Event != itemEventDeleted || msg.Item.ID != book.ID || msg.Item.DeletedAt == nil {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if _, err := h.itemRepo.AddImages(ctx, coat.ID, []string{"coat-back.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(); msg.Event != itemEventUpdated || msg.Item.ID != coat.ID || len(msg.Item.Images) != 2 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	sendWebSocket(t, ws, WSClientMessage{Type: wsUnsubscribe, CategoryIDs: []int{fashion.ID}})
+	if msg := receive(); msg.Type != wsSubscribed || msg.CategoryIDs != nil || !cmp.Equal(msg.ItemIDs, []int{book.ID}) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	t.Run("rejects invalid messages", func(t *testing.T) {
+		tooMany := make([]int, wsMaxSubscriptions+1)
+		for i := range tooMany {
+			tooMany[i] = i + 1
+		}
+		cases := map[string]any{
+			"unknown type":     WSClientMessage{Type: "publish"},
+			"unknown category": WSClientMessage{Type: wsSubscribe, CategoryIDs: []int{books.ID + 100}},
+			"too many items":   WSClientMessage{Type: wsSubscribe, ItemIDs: tooMany},
+			"invalid JSON":     `{"type":`,
+			"too large":        `{"type":"subscribe","item_ids":[` + strings.Repeat("1,", wsMaxMessageBytes/2) + `1]}`,
+			"invalid item ID":  `{"type":"subscribe","item_ids":["a"]}`,
+		}
+		for name, msg := range cases {
+			sendWebSocket(t, ws, msg)
+			if got := receive(); got.Type != wsError || got.Message == "" {
+				t.Errorf("%s: expected an error, got %+v", name, got)
+			}
+		}
+	})
+
+	t.Run("resumes from the last event", func(t *testing.T) {
+		ws, receive := dialItemsWebSocket(t, srv, "secret")
+		sendWebSocket(t, ws, WSClientMessage{Type: wsSubscribe, CategoryIDs: []int{books.ID}, LastEventID: created.ID})
+		if msg := receive(); msg.Type != wsSubscribed {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+		var got []string
+		for _, want := range []int{novel.ID, book.ID} {
+			msg := receive()
+			got = append(got, msg.Event+":"+msg.Item.Name)
+			if msg.Item.ID != want {
+				t.Errorf("expected item %d, got %+v", want, msg)
+			}
+		}
+		if diff := cmp.Diff([]string{"item.created:novel", "item.deleted:book"}, got); diff != "" {
+			t.Errorf("unexpected events (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestItemsWebSocketEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	itemRepo, memoryCategories := NewMemoryRepositories()
+	categoryRepo := &blockingCategoryRepository{CategoryRepository: memoryCategories, called: make(chan struct{}, 1), release: make(chan struct{})}
+	h := &Handlers{
+		imgDirPath:   t.TempDir(),
+		clientTokens: []string{"app-token"},
+		categoryRepo: categoryRepo,
+		events:       newEventBroker(defaultEventHistory, 1),
+	}
+	h.itemRepo = &publishingItemRepository{ItemRepository: itemRepo, publish: h.publishItemEvent}
+	srv := httptest.NewServer(newValidatedMux(t, h))
+	t.Cleanup(srv.Close)
+
+	fashion := &Category{Name: "fashion"}
+	if err := memoryCategories.Create(ctx, fashion); err != nil {
+		t.Fatal(err)
+	}
+
+	// the handler is busy with the subscription while the events are published, so its buffer fills up
+	ws, _ := dialItemsWebSocket(t, srv, "app-token")
+	sendWebSocket(t, ws, WSClientMessage{Type: wsSubscribe, CategoryIDs: []int{fashion.ID}})
+	<-categoryRepo.called
+	for i := range 3 {
+		if err := h.itemRepo.Insert(ctx, &Item{Name: "jacket" + strconv.Itoa(i), CategoryID: fashion.ID, Image: "a.jpg"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(categoryRepo.release)
+
+	// the client is told why it is closed, after the messages sent before
+	if err := ws.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for {
+		var msg WSServerMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			break
+		}
+		types = append(types, msg.Type)
+		if msg.Type == wsError {
+			var raw json.RawMessage
+			if err := websocket.JSON.Receive(ws, &raw); err == nil {
+				t.Errorf("expected the connection to be closed, got %s", raw)
+			}
+			break
+		}
+	}
+	if len(types) == 0 || types[0] != wsSubscribed || types[len(types)-1] != wsError {
+		t.Errorf("expected the subscription to be answered and then evicted, got %v", types)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !purego
+
+package app
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is the name of the SQLite driver, which is github.com/mattn/go-sqlite3 using CGO.
+// Build with the purego tag to use the pure-Go driver instead.
+const sqliteDriverName = "sqlite3"
+
+// sqliteDSN builds the data source name of the SQLite database at dbPath.
+// Foreign keys are enforced, and transactions take the write lock when they begin
+// so that concurrent transactions wait for each other instead of failing with "database is locked".
+// The database is in WAL mode, where readers don't block the writer and vice versa.
+func sqliteDSN(dbPath string) string {
+	return "file:" + dbPath + "?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL"
+}
+
+// sqliteReaderDSN builds the data source name of the read-only connections to the SQLite database at dbPath.
+func sqliteReaderDSN(dbPath string) string {
+	return "file:" + dbPath + "?_foreign_keys=on&_busy_timeout=5000&_query_only=on"
+}
+
+// isSQLiteBusy reports whether err is SQLITE_BUSY, which is returned when another connection,
+// e.g. of cmd/gc, holds the write lock longer than the busy timeout.
+func isSQLiteBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrBusy
+}
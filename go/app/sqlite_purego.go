@@ -0,0 +1,34 @@
+//go:build purego
+
+package app
+
+import (
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDriverName is the name of the SQLite driver, which is modernc.org/sqlite written in pure Go.
+// It lets the server be built with CGO_ENABLED=0, e.g. to cross-compile static binaries.
+const sqliteDriverName = "sqlite"
+
+// sqliteDSN builds the data source name of the SQLite database at dbPath.
+// The options are the same as the ones for github.com/mattn/go-sqlite3, and times are written
+// in the same format so that both drivers can open the same database file.
+func sqliteDSN(dbPath string) string {
+	return "file:" + dbPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate&_pragma=journal_mode(WAL)&_time_format=sqlite"
+}
+
+// sqliteReaderDSN builds the data source name of the read-only connections to the SQLite database at dbPath.
+func sqliteReaderDSN(dbPath string) string {
+	return "file:" + dbPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=query_only(1)&_time_format=sqlite"
+}
+
+// isSQLiteBusy reports whether err is SQLITE_BUSY, which is returned when another connection,
+// e.g. of cmd/gc, holds the write lock longer than the busy timeout.
+func isSQLiteBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	// the lower byte is the primary result code without the extended one
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+}
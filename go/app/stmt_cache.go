@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// stmtCache holds the statements prepared on a connection pool keyed by their queries,
+// so that each query is parsed once instead of on every call.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// newStmtCache creates a stmtCache on db with the queries prepared beforehand.
+func newStmtCache(ctx context.Context, db *sql.DB, queries ...string) (*stmtCache, error) {
+	c := &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+	for _, query := range queries {
+		if _, err := c.prepare(ctx, query); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// prepare returns the statement of query, which is prepared on the first call.
+// It needs a free connection of the pool, so it must not be called while the caller holds a transaction
+// on a pool with a single connection. Use lookup instead in transactions.
+func (c *stmtCache) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt := c.lookup(query); stmt != nil {
+		return stmt, nil
+	}
+
+	// the lock isn't held while waiting for a connection, which may be held by a transaction calling lookup
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prepared, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return prepared, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// lookup returns the statement of query if it has been prepared, and nil otherwise.
+// It is safe to call on a nil stmtCache.
+func (c *stmtCache) lookup(query string) *sql.Stmt {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stmts[query]
+}
+
+// Close closes all the prepared statements.
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	return errors.Join(errs...)
+}
+
+// errRow is a rowScanner which fails with err, e.g. when the statement couldn't be prepared.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
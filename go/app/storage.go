@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The drivers of the databases selectable by StorageConfig.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+	// DriverMemory keeps data in memory, which is lost when the process exits.
+	// It needs neither a database nor CGO, so it is handy for demos.
+	DriverMemory = "memory"
+)
+
+// defaultSQLitePath is the SQLite database used when no source is configured.
+const defaultSQLitePath = "db/mercari.sqlite3"
+
+// StorageConfig selects the database storing items and categories.
+type StorageConfig struct {
+	// Driver is DriverSQLite, DriverPostgres or DriverMemory. SQLite is used when it is empty.
+	Driver string
+	// Source is the file path of the SQLite database, or the connection URL of the PostgreSQL database.
+	// It is ignored by DriverMemory.
+	Source string
+	// MaxOpenConns is the maximum number of open connections for reads, or for both reads and writes of PostgreSQL.
+	// The SQLite writer always has a single connection. There is no limit when it is zero.
+	MaxOpenConns int
+	// ConnMaxLifetime is the maximum time a connection may be reused. Connections are reused forever when it is zero.
+	ConnMaxLifetime time.Duration
+}
+
+// configurePool applies the settings of the connection pool.
+func (cfg StorageConfig) configurePool(db *sql.DB) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxOpenConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
+
+// Storage holds the repositories on the database opened by OpenStorage.
+type Storage struct {
+	Items      ItemRepository
+	Categories CategoryRepository
+	// Webhooks has the outbox of the events of Items, which is written in their transactions.
+	Webhooks WebhookRepository
+	// Tx runs functions in transactions spanning Items, Categories and Webhooks.
+	Tx TxManager
+	// pools are the connection pools keyed by their roles. It is empty for DriverMemory.
+	pools map[string]*sql.DB
+	// closers release the resources on the pools, e.g. prepared statements, before the pools are closed.
+	closers []io.Closer
+}
+
+// OpenStorage opens the database selected by cfg and creates the tables.
+func OpenStorage(ctx context.Context, cfg StorageConfig) (*Storage, error) {
+	switch cfg.Driver {
+	case "", DriverSQLite:
+		if cfg.Source == "" {
+			cfg.Source = defaultSQLitePath
+		}
+		return openSQLiteStorage(ctx, cfg, "db/items.sql")
+	case DriverPostgres:
+		db, err := OpenPostgres(ctx, cfg.Source, "db/items.postgres.sql")
+		if err != nil {
+			return nil, err
+		}
+		cfg.configurePool(db)
+		items, err := newItemRepository(ctx, db, nil, dialectPostgres)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &Storage{
+			Items:      items,
+			Categories: NewPostgresCategoryRepository(db),
+			Webhooks:   NewPostgresWebhookRepository(db),
+			Tx:         NewPostgresTxManager(db),
+			pools:      map[string]*sql.DB{"primary": db},
+			closers:    []io.Closer{items},
+		}, nil
+	case DriverMemory:
+		items, categories := NewMemoryRepositories()
+		return &Storage{Items: items, Categories: categories, Webhooks: NewMemoryWebhookRepository(), Tx: memoryTxManager{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// openSQLiteStorage opens the SQLite database with a single writer connection and a pool of read-only connections.
+// In WAL mode, reads run in parallel with each other and with the writer.
+func openSQLiteStorage(ctx context.Context, cfg StorageConfig, sqlPath string) (*Storage, error) {
+	writer, err := OpenDB(ctx, cfg.Source, sqlPath)
+	if err != nil {
+		return nil, err
+	}
+	writer.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	reader, err := sql.Open(sqliteDriverName, sqliteReaderDSN(cfg.Source))
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	cfg.configurePool(reader)
+
+	items, err := newItemRepository(ctx, writer, reader, dialectSQLite)
+	if err != nil {
+		reader.Close()
+		writer.Close()
+		return nil, err
+	}
+	return &Storage{
+		Items:      items,
+		Categories: &categoryRepository{db: writer, readDB: reader, dialect: dialectSQLite},
+		Webhooks:   NewWebhookRepository(writer),
+		Tx:         NewTxManager(writer),
+		pools:      map[string]*sql.DB{"writer": writer, "reader": reader},
+		closers:    []io.Closer{items},
+	}, nil
+}
+
+// Stats returns the statistics of the connection pools keyed by their roles, e.g. "writer" and "reader" of SQLite.
+func (s *Storage) Stats() map[string]sql.DBStats {
+	stats := make(map[string]sql.DBStats, len(s.pools))
+	for role, db := range s.pools {
+		stats[role] = db.Stats()
+	}
+	return stats
+}
+
+// Close closes the database.
+func (s *Storage) Close() error {
+	var errs []error
+	for _, c := range s.closers {
+		errs = append(errs, c.Close())
+	}
+	for _, db := range s.pools {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// setupSQLiteStorage opens the storage on a temporary SQLite database with the writer and reader pools.
+func setupSQLiteStorage(t testing.TB, cfg StorageConfig) *Storage {
+	t.Helper()
+
+	f, err := os.CreateTemp(".", "*.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	f.Close()
+	t.Cleanup(func() { removeSQLiteFiles(f.Name()) })
+
+	cfg.Source = f.Name()
+	storage, err := openSQLiteStorage(context.Background(), cfg, "../db/items.sql")
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestSQLiteStorageReadsDuringWrite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	storage := setupSQLiteStorage(t, StorageConfig{MaxOpenConns: 4, ConnMaxLifetime: time.Minute})
+	ctx := context.Background()
+	phone := &Category{Name: "phone"}
+	if err := storage.Categories.Create(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a transaction holds the write lock and the only writer connection
+	tx, err := storage.pools["writer"].BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET name = 'locked'"); err != nil {
+		t.Fatal(err)
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	resp, err := storage.Items.GetAll(readCtx, ItemQuery{})
+	if err != nil {
+		t.Fatalf("failed to read during a write: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].Name != "iPhone" {
+		t.Errorf("expected the committed item, got %+v", resp.Items)
+	}
+
+	// the readers can't write even if they are misused
+	if _, err := storage.pools["reader"].ExecContext(readCtx, "DELETE FROM items"); err == nil {
+		t.Error("expected the reader to reject writes")
+	}
+
+	stats := storage.Stats()
+	if stats["writer"].MaxOpenConnections != 1 {
+		t.Errorf("expected a single writer connection, got %d", stats["writer"].MaxOpenConnections)
+	}
+	if stats["reader"].MaxOpenConnections != 4 {
+		t.Errorf("expected 4 reader connections, got %d", stats["reader"].MaxOpenConnections)
+	}
+}
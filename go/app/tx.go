@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// TxManager runs functions in database transactions spanning the repositories.
+type TxManager interface {
+	// WithinTx runs fn in a transaction, which is committed when fn returns nil and rolled back otherwise.
+	// The repositories called with the context given to fn join the transaction.
+	// When ctx already has a transaction, fn runs in a savepoint of it instead, so that an error of fn
+	// rolls back only the changes made by fn and the outermost call decides whether everything is committed.
+	// fn may be called again when the transaction is retried, so it must not have side effects outside the database.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// The default retries of transactions which failed because the database was busy.
+const (
+	defaultTxMaxRetries = 5
+	defaultTxBackoff    = 10 * time.Millisecond
+)
+
+type txKey struct{}
+
+// txState is a transaction stored in a context.
+type txState struct {
+	// db is the pool the transaction was begun on, so that repositories on other databases don't join it.
+	db *sql.DB
+	tx *sql.Tx
+	// depth is the number of savepoints enclosing the current call.
+	depth int
+	// afterCommit are the functions registered by runAfterCommit in the transaction or the savepoint.
+	afterCommit []func()
+}
+
+// txFromContext returns the transaction of ctx begun on db, or nil if there is none.
+func txFromContext(ctx context.Context, db *sql.DB) *sql.Tx {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok || state.db != db {
+		return nil
+	}
+	return state.tx
+}
+
+// runAfterCommit runs fn once the transaction of ctx begun by a TxManager is committed, or right away when there is none.
+// fn is dropped when the transaction, or the savepoint it was registered in, is rolled back.
+func runAfterCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.afterCommit = append(state.afterCommit, fn)
+		return
+	}
+	fn()
+}
+
+// inTx runs fn in the transaction of ctx begun on db, or in a new transaction when there is none.
+// It is used by repositories, whose changes are applied all together or not at all either way.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok && state.db == db {
+		return state.savepoint(ctx, func(context.Context) error { return fn(state.tx) })
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// savepoint runs fn in a savepoint of the transaction, which is rolled back when fn fails.
+func (s *txState) savepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	name := "sp" + strconv.Itoa(s.depth+1)
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	nested := &txState{db: s.db, tx: s.tx, depth: s.depth + 1}
+	err := fn(context.WithValue(ctx, txKey{}, nested))
+	if err != nil {
+		if _, rbErr := s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return rbErr
+		}
+	}
+	// ROLLBACK TO keeps the savepoint, so it is released either way
+	if _, relErr := s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); relErr != nil {
+		return relErr
+	}
+	if err == nil {
+		// the functions of the savepoint wait for the outermost transaction
+		s.afterCommit = append(s.afterCommit, nested.afterCommit...)
+	}
+	return err
+}
+
+// sqlTxManager is an implementation of TxManager on a database/sql pool.
+type sqlTxManager struct {
+	db *sql.DB
+	// isRetryable reports whether a failed transaction may succeed when it is run again.
+	// Transactions are never retried when it is nil.
+	isRetryable func(err error) bool
+	maxRetries  int
+	// backoff is the wait before the first retry, which doubles on each retry.
+	backoff time.Duration
+}
+
+// NewTxManager creates a TxManager on the SQLite database, which retries transactions
+// failing because another process holds the write lock.
+func NewTxManager(db *sql.DB) TxManager {
+	return &sqlTxManager{db: db, isRetryable: isSQLiteBusy, maxRetries: defaultTxMaxRetries, backoff: defaultTxBackoff}
+}
+
+// NewPostgresTxManager creates a TxManager on the PostgreSQL database.
+func NewPostgresTxManager(db *sql.DB) TxManager {
+	return &sqlTxManager{db: db}
+}
+
+func (m *sqlTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok && state.db == m.db {
+		return state.savepoint(ctx, fn)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.run(ctx, fn)
+		if err == nil || m.isRetryable == nil || !m.isRetryable(err) || attempt >= m.maxRetries {
+			return err
+		}
+
+		// jitter keeps the retries of concurrent transactions from colliding again
+		wait := m.backoff << attempt
+		wait += rand.N(wait + 1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// run runs fn in a new transaction.
+func (m *sqlTxManager) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	state := &txState{db: m.db, tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range state.afterCommit {
+		f()
+	}
+	return nil
+}
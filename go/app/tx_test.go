@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithinTxE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	errFailed := errors.New("failed")
+
+	cases := map[string]struct {
+		fn             func(ctx context.Context, storage *Storage) error
+		wantErr        error
+		wantCategories int
+		wantItems      int
+	}{
+		"commits the changes of both repositories": {
+			fn: func(ctx context.Context, storage *Storage) error {
+				phone := &Category{Name: "phone"}
+				if err := storage.Categories.Create(ctx, phone); err != nil {
+					return err
+				}
+				return storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"})
+			},
+			wantCategories: 1,
+			wantItems:      1,
+		},
+		"rolls back the changes of both repositories": {
+			fn: func(ctx context.Context, storage *Storage) error {
+				phone := &Category{Name: "phone"}
+				if err := storage.Categories.Create(ctx, phone); err != nil {
+					return err
+				}
+				if err := storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"}); err != nil {
+					return err
+				}
+				return errFailed
+			},
+			wantErr: errFailed,
+		},
+		"rolls back only the nested call": {
+			fn: func(ctx context.Context, storage *Storage) error {
+				phone := &Category{Name: "phone"}
+				if err := storage.Categories.Create(ctx, phone); err != nil {
+					return err
+				}
+				err := storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+					if err := storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"}); err != nil {
+						return err
+					}
+					return errFailed
+				})
+				if !errors.Is(err, errFailed) {
+					t.Errorf("expected the nested call to fail with %v, got %v", errFailed, err)
+				}
+				return nil
+			},
+			wantCategories: 1,
+		},
+		"keeps the transaction usable after a repository fails": {
+			fn: func(ctx context.Context, storage *Storage) error {
+				err := storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: 999, Image: "a.jpg"})
+				if !errors.Is(err, errCategoryNotFound) {
+					t.Errorf("expected %v, got %v", errCategoryNotFound, err)
+				}
+				phone := &Category{Name: "phone"}
+				if err := storage.Categories.Create(ctx, phone); err != nil {
+					return err
+				}
+				// the category created in the transaction is visible to it
+				if _, err := storage.Categories.GetByID(ctx, phone.ID); err != nil {
+					return err
+				}
+				return storage.Items.Insert(ctx, &Item{Name: "iPhone", CategoryID: phone.ID, Image: "a.jpg"})
+			},
+			wantCategories: 1,
+			wantItems:      1,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			storage := setupSQLiteStorage(t, StorageConfig{MaxOpenConns: 4})
+			ctx := context.Background()
+
+			err := storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+				return tt.fn(ctx, storage)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			categories, err := storage.Categories.GetAll(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(categories) != tt.wantCategories {
+				t.Errorf("expected %d categories, got %d", tt.wantCategories, len(categories))
+			}
+			items, err := storage.Items.GetAll(ctx, ItemQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items.Items) != tt.wantItems {
+				t.Errorf("expected %d items, got %d", tt.wantItems, len(items.Items))
+			}
+		})
+	}
+}
+
+func TestWithinTxRetry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	errBusy := errors.New("busy")
+	errFailed := errors.New("failed")
+
+	cases := map[string]struct {
+		// errs are the errors returned by the attempts in order. The attempts after them succeed.
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		"succeeds after retries": {
+			errs:         []error{errBusy, errBusy},
+			wantAttempts: 3,
+		},
+		"gives up after the maximum retries": {
+			errs:         []error{errBusy, errBusy, errBusy, errBusy},
+			wantErr:      errBusy,
+			wantAttempts: 3,
+		},
+		"doesn't retry other errors": {
+			errs:         []error{errFailed},
+			wantErr:      errFailed,
+			wantAttempts: 1,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			storage := setupSQLiteStorage(t, StorageConfig{})
+			m := &sqlTxManager{
+				db:          storage.pools["writer"],
+				isRetryable: func(err error) bool { return errors.Is(err, errBusy) },
+				maxRetries:  2,
+				backoff:     time.Millisecond,
+			}
+
+			attempts := 0
+			err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUploadTTL is how long an incomplete resumable upload is kept after its last chunk.
+const DefaultUploadTTL = 24 * time.Hour
+
+// uploadCleanupInterval is the interval of removing the expired resumable uploads.
+const uploadCleanupInterval = 10 * time.Minute
+
+// maxUploadLength is the maximum size of a resumable upload, which is the same as the limit of multipart forms.
+const maxUploadLength = 32 << 20
+
+var (
+	errUploadNotFound       = errors.New("upload not found")
+	errUploadOffsetMismatch = errors.New("Upload-Offset doesn't match the offset of the upload")
+	errUploadTooLarge       = errors.New("the chunk exceeds Upload-Length")
+	errUploadLocked         = errors.New("another chunk of the upload is being written")
+)
+
+// uploadIDPattern matches the IDs generated by uploadStore.create.
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// uploadStore keeps the resumable uploads in a temporary directory until they are complete.
+// An upload is a pair of files: <id>.part holds the bytes received so far, so its size is the offset,
+// and <id>.json holds uploadInfo. Both survive restarts of the server, so the clients can resume after them.
+type uploadStore struct {
+	dirPath string
+	// storeImage stores a complete upload and returns its image ID, which is storeImage of Handlers.
+	storeImage func(image []byte) (string, error)
+
+	mu sync.Mutex
+	// locked has the IDs of the uploads whose chunk is being written.
+	locked map[string]bool
+}
+
+// uploadInfo is the metadata of an upload.
+type uploadInfo struct {
+	Length int64 `json:"length"`
+	// ImageID is set once the upload is complete and stored as an image.
+	ImageID string `json:"image_id,omitempty"`
+}
+
+// uploadStatus is the progress of an upload.
+type uploadStatus struct {
+	uploadInfo
+	Offset int64
+}
+
+// newUploadStore creates the directory of the uploads if it doesn't exist.
+func newUploadStore(dirPath string, storeImage func(image []byte) (string, error)) (*uploadStore, error) {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &uploadStore{dirPath: dirPath, storeImage: storeImage, locked: make(map[string]bool)}, nil
+}
+
+func (u *uploadStore) partPath(id string) string {
+	return filepath.Join(u.dirPath, id+".part")
+}
+
+func (u *uploadStore) infoPath(id string) string {
+	return filepath.Join(u.dirPath, id+".json")
+}
+
+// create starts an upload of length bytes and returns its ID.
+func (u *uploadStore) create(length int64) (string, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	if err := os.WriteFile(u.partPath(id), nil, 0644); err != nil {
+		return "", err
+	}
+	if err := u.writeInfo(id, uploadInfo{Length: length}); err != nil {
+		os.Remove(u.partPath(id))
+		return "", err
+	}
+	return id, nil
+}
+
+func (u *uploadStore) writeInfo(id string, info uploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.infoPath(id), data, 0644)
+}
+
+// status returns the progress of an upload. A complete upload has the offset of its length.
+func (u *uploadStore) status(id string) (*uploadStatus, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, errUploadNotFound
+	}
+	data, err := os.ReadFile(u.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errUploadNotFound
+		}
+		return nil, err
+	}
+	st := &uploadStatus{}
+	if err := json.Unmarshal(data, &st.uploadInfo); err != nil {
+		return nil, fmt.Errorf("broken upload %s: %w", id, err)
+	}
+	if st.ImageID != "" {
+		st.Offset = st.Length
+		return st, nil
+	}
+
+	fi, err := os.Stat(u.partPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errUploadNotFound
+		}
+		return nil, err
+	}
+	st.Offset = fi.Size()
+	return st, nil
+}
+
+// lock marks the upload as being written, so that concurrent chunks don't interleave.
+func (u *uploadStore) lock(id string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.locked[id] {
+		return false
+	}
+	u.locked[id] = true
+	return true
+}
+
+func (u *uploadStore) unlock(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.locked, id)
+}
+
+// append writes a chunk at the offset and stores the image when the upload becomes complete.
+// When reading the chunk fails midway, the bytes received so far are kept
+// and the returned status has the offset to resume from.
+func (u *uploadStore) append(id string, offset int64, chunk io.Reader) (*uploadStatus, error) {
+	if !u.lock(id) {
+		return nil, errUploadLocked
+	}
+	defer u.unlock(id)
+
+	st, err := u.status(id)
+	if err != nil {
+		return nil, err
+	}
+	if st.ImageID != "" || offset != st.Offset {
+		return nil, errUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(u.partPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// one more byte is read to tell the chunks exceeding the length
+	n, copyErr := io.Copy(f, io.LimitReader(chunk, st.Length-st.Offset+1))
+	if st.Offset+n > st.Length {
+		err := f.Truncate(st.Offset)
+		f.Close()
+		return nil, errors.Join(errUploadTooLarge, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	st.Offset += n
+	if copyErr != nil {
+		return st, fmt.Errorf("failed to read chunk: %w", copyErr)
+	}
+
+	if st.Offset == st.Length {
+		if err := u.finish(id, st); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// finish stores the complete upload as an image. The metadata is kept until the TTL expires,
+// so that a client which missed the response can still find the image ID with HEAD.
+func (u *uploadStore) finish(id string, st *uploadStatus) error {
+	image, err := os.ReadFile(u.partPath(id))
+	if err != nil {
+		return err
+	}
+	st.ImageID, err = u.storeImage(image)
+	if err != nil {
+		return err
+	}
+	if err := u.writeInfo(id, st.uploadInfo); err != nil {
+		return err
+	}
+	return os.Remove(u.partPath(id))
+}
+
+// cleanup removes the uploads which haven't received any chunk for ttl and returns their IDs.
+func (u *uploadStore) cleanup(ttl time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(u.dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload directory: %w", err)
+	}
+
+	// the last activity of an upload is the latest modification of its files
+	lastActive := make(map[string]time.Time)
+	for _, entry := range entries {
+		id, _, found := strings.Cut(entry.Name(), ".")
+		if !found || entry.IsDir() || !uploadIDPattern.MatchString(id) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(lastActive[id]) {
+			lastActive[id] = info.ModTime()
+		}
+	}
+
+	var removed []string
+	threshold := time.Now().Add(-ttl)
+	for id, t := range lastActive {
+		if t.After(threshold) || !u.lock(id) {
+			continue
+		}
+		err := errors.Join(removeIfExists(u.partPath(id)), removeIfExists(u.infoPath(id)))
+		u.unlock(id)
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove upload: %w", err)
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// runCleanupPeriodically removes the expired uploads every uploadCleanupInterval until ctx is done.
+func (u *uploadStore) runCleanupPeriodically(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := u.cleanup(ttl)
+			if err != nil {
+				slog.Error("failed to clean up uploads: ", "error", err)
+				continue
+			}
+			if len(removed) > 0 {
+				slog.Info("removed expired uploads", "removed", len(removed))
+			}
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is a value of a request which doesn't match the OpenAPI document.
+type ValidationError struct {
+	// In is where the value is, which is "path", "query", "form" or "body".
+	In string `json:"in"`
+	// Name is the name of the parameter or the form field, or the JSON pointer to the value in the body, e.g. "/image_ids/0".
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse lists all the invalid values of a request.
+type ValidationErrorResponse struct {
+	Message string            `json:"message"`
+	Errors  []ValidationError `json:"errors"`
+}
+
+// maxFormMemory is the memory used to parse multipart forms, which is the same as readImageFiles.
+const maxFormMemory = 32 << 20
+
+// requestValidator validates requests against the OpenAPI document before they reach the handlers.
+type requestValidator struct {
+	doc *openAPIDocument
+	// onResponseError is called when a response doesn't match the document, e.g. to fail tests.
+	// Responses are only validated when it is set, as they are buffered to be validated.
+	onResponseError func(r *http.Request, err error)
+}
+
+// newRequestValidator creates a requestValidator of the operations keyed by the patterns of http.ServeMux.
+func newRequestValidator(ops map[string]apiOperation) (*requestValidator, error) {
+	doc, err := buildOpenAPIDocument(ops)
+	if err != nil {
+		return nil, err
+	}
+	return &requestValidator{doc: doc}, nil
+}
+
+// validatingMux registers the handlers on mux with the validation of their requests.
+type validatingMux struct {
+	mux routeRegistrar
+	v   *requestValidator
+}
+
+// HandleFunc registers the handler for the pattern. It panics if the pattern isn't documented.
+func (m validatingMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	method, path, _ := strings.Cut(pattern, " ")
+	op := m.v.doc.Paths[pathParamPattern.ReplaceAllString(path, "{$1}")][strings.ToLower(method)]
+	if op == nil {
+		panic(fmt.Sprintf("route %s is not documented in apiOperations", pattern))
+	}
+	m.mux.HandleFunc(pattern, m.v.middleware(op, handler))
+}
+
+// middleware rejects the requests which don't match op with all of their errors.
+func (v *requestValidator) middleware(op *openAPIOperation, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if errs := v.validateRequest(w, op, r); len(errs) > 0 {
+			code := http.StatusBadRequest
+			switch {
+			case slices.ContainsFunc(errs, isContentTypeError):
+				code = http.StatusUnsupportedMediaType
+			case slices.ContainsFunc(errs, isBodyTooLargeError):
+				code = http.StatusRequestEntityTooLarge
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(ValidationErrorResponse{Message: "invalid request", Errors: errs})
+			return
+		}
+		// streams are sent as they are written, so they can't be buffered to be validated
+		if v.onResponseError == nil || isStreaming(op) {
+			next(w, r)
+			return
+		}
+
+		res := &bufferedResponse{header: make(http.Header)}
+		next(res, r)
+		if res.code == 0 {
+			res.code = http.StatusOK
+		}
+		if err := v.validateResponse(op, res); err != nil {
+			v.onResponseError(r, err)
+		}
+		maps.Copy(w.Header(), res.header)
+		w.WriteHeader(res.code)
+		w.Write(res.body.Bytes())
+	}
+}
+
+// isContentTypeError reports whether the body was sent in an undocumented media type.
+func isContentTypeError(e ValidationError) bool {
+	return e.In == "header" && e.Name == "Content-Type"
+}
+
+// errBodyTooLarge is the error of the JSON bodies exceeding maxJSONBodySize.
+var errBodyTooLarge = ValidationError{In: "body", Message: fmt.Sprintf("must be at most %d bytes", maxJSONBodySize)}
+
+// isBodyTooLargeError reports whether the body was cut off at maxJSONBodySize.
+func isBodyTooLargeError(e ValidationError) bool {
+	return e == errBodyTooLarge
+}
+
+// validateRequest returns the errors of the parameters and the body of r.
+func (v *requestValidator) validateRequest(w http.ResponseWriter, op *openAPIOperation, r *http.Request) []ValidationError {
+	var errs []ValidationError
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value = r.PathValue(p.Name)
+			present = value != ""
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+			present = value != ""
+		}
+		if !present {
+			if p.Required {
+				errs = append(errs, ValidationError{In: p.In, Name: p.Name, Message: "is required"})
+			}
+			continue
+		}
+		errs = append(errs, v.validateString(p.In, p.Name, p.Schema, value)...)
+	}
+
+	if op.RequestBody != nil {
+		mediaType, media, err := negotiateBody(op.RequestBody, r)
+		switch {
+		case err != nil:
+			errs = append(errs, *err)
+		case mediaType == "application/json":
+			errs = append(errs, v.validateJSONBody(w, r, media.Schema)...)
+		case mediaType == "multipart/form-data":
+			errs = append(errs, v.validateForm(r, media.Schema)...)
+		}
+		// the other bodies, e.g. the chunks of resumable uploads, are left to the handlers
+	}
+	return errs
+}
+
+// negotiateBody chooses the documented body matching the Content-Type of the request.
+// A body documented in a single media type is validated as such whatever the header says,
+// as the handlers of JSON bodies don't look at it either.
+func negotiateBody(body *openAPIRequestBody, r *http.Request) (string, openAPIMediaType, *ValidationError) {
+	if len(body.Content) == 1 {
+		for mediaType, media := range body.Content {
+			return mediaType, media, nil
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if media, ok := body.Content[mediaType]; ok {
+		return mediaType, media, nil
+	}
+	return "", openAPIMediaType{}, &ValidationError{
+		In:      "header",
+		Name:    "Content-Type",
+		Message: "must be one of " + strings.Join(slices.Sorted(maps.Keys(body.Content)), ", "),
+	}
+}
+
+// validateJSONBody validates the JSON body of r. The body is kept to be read again by the handler.
+// It is read up to maxJSONBodySize, as the whole body is read in memory before the handler runs.
+func (v *requestValidator) validateJSONBody(w http.ResponseWriter, r *http.Request, schema *jsonSchema) []ValidationError {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+	if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+		return []ValidationError{errBodyTooLarge}
+	}
+	if err != nil {
+		return []ValidationError{{In: "body", Message: "failed to read"}}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	value, err := decodeJSONValue(body)
+	if err != nil {
+		return []ValidationError{{In: "body", Message: "must be valid JSON"}}
+	}
+	return v.validateValue("body", "", schema, value)
+}
+
+// validateForm validates the fields of the multipart form of r.
+// The parsed form is kept in r, so the handler doesn't parse it again.
+func (v *requestValidator) validateForm(r *http.Request, schema *jsonSchema) []ValidationError {
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+		return []ValidationError{{In: "form", Message: "must be a multipart form"}}
+	}
+
+	var errs []ValidationError
+	for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+		prop := schema.Properties[name]
+		required := slices.Contains(schema.Required, name)
+
+		if isFileSchema(prop) || (prop.Type == "array" && isFileSchema(prop.Items)) {
+			files := r.MultipartForm.File[name]
+			switch {
+			case len(files) == 0 && required:
+				errs = append(errs, ValidationError{In: "form", Name: name, Message: "is required"})
+			case len(files) > 1 && prop.Type != "array":
+				errs = append(errs, ValidationError{In: "form", Name: name, Message: "must be a single file"})
+			}
+			continue
+		}
+
+		values := r.MultipartForm.Value[name]
+		if len(values) == 0 {
+			if required {
+				errs = append(errs, ValidationError{In: "form", Name: name, Message: "is required"})
+			}
+			continue
+		}
+		errs = append(errs, v.validateString("form", name, prop, values[0])...)
+	}
+	return errs
+}
+
+// isFileSchema reports whether the schema is a file of a multipart form.
+func isFileSchema(schema *jsonSchema) bool {
+	return schema != nil && schema.Type == "string" && schema.ContentMediaType != ""
+}
+
+// validateString validates a parameter or a form field, which is a string converted to the type of the schema.
+func (v *requestValidator) validateString(in, name string, schema *jsonSchema, s string) []ValidationError {
+	var value any = s
+	switch typ := primaryType(schema); typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return []ValidationError{{In: in, Name: name, Message: "must be " + typ}}
+		}
+		value = json.Number(s)
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return []ValidationError{{In: in, Name: name, Message: "must be boolean"}}
+		}
+		value = b
+	}
+	return v.validateValue(in, name, schema, value)
+}
+
+// primaryType returns the type of the schema other than null.
+func primaryType(schema *jsonSchema) string {
+	for _, typ := range schemaTypes(schema) {
+		if typ != "null" {
+			return typ
+		}
+	}
+	return ""
+}
+
+func schemaTypes(schema *jsonSchema) []string {
+	switch typ := schema.Type.(type) {
+	case string:
+		return []string{typ}
+	case []string:
+		return typ
+	}
+	return nil
+}
+
+// jsonPointerEscaper escapes the keys of objects in JSON pointers.
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// validateValue validates a value decoded by decodeJSONValue, whose location is name.
+func (v *requestValidator) validateValue(in, name string, schema *jsonSchema, value any) []ValidationError {
+	if schema.Ref != "" {
+		return v.validateValue(in, name, v.resolve(schema.Ref), value)
+	}
+	if len(schema.AnyOf) > 0 {
+		for _, s := range schema.AnyOf {
+			if len(v.validateValue(in, name, s, value)) == 0 {
+				return nil
+			}
+		}
+		return []ValidationError{{In: in, Name: name, Message: "must match one of the allowed schemas"}}
+	}
+	if types := schemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(typ string) bool { return hasJSONType(value, typ) }) {
+		return []ValidationError{{In: in, Name: name, Message: "must be " + strings.Join(types, " or ")}}
+	}
+
+	var errs []ValidationError
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(value) }) {
+		errs = append(errs, ValidationError{In: in, Name: name, Message: fmt.Sprintf("must be one of %v", schema.Enum)})
+	}
+	switch value := value.(type) {
+	case json.Number:
+		n, _ := value.Float64()
+		if schema.Minimum != nil && n < float64(*schema.Minimum) {
+			errs = append(errs, ValidationError{In: in, Name: name, Message: fmt.Sprintf("must be at least %d", *schema.Minimum)})
+		}
+		if schema.Maximum != nil && n > float64(*schema.Maximum) {
+			errs = append(errs, ValidationError{In: in, Name: name, Message: fmt.Sprintf("must be at most %d", *schema.Maximum)})
+		}
+	case string:
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				errs = append(errs, ValidationError{In: in, Name: name, Message: "must be a date-time"})
+			}
+		}
+		if schema.ContentEncoding == "base64" {
+			if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+				errs = append(errs, ValidationError{In: in, Name: name, Message: "must be encoded in base64"})
+			}
+		}
+	case []any:
+		if schema.Items != nil {
+			for n, item := range value {
+				errs = append(errs, v.validateValue(in, name+"/"+strconv.Itoa(n), schema.Items, item)...)
+			}
+		}
+	case map[string]any:
+		for _, key := range schema.Required {
+			if _, ok := value[key]; !ok {
+				errs = append(errs, ValidationError{In: in, Name: name + "/" + jsonPointerEscaper.Replace(key), Message: "is required"})
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			s := schema.Properties[key]
+			if s == nil {
+				s = schema.AdditionalProperties
+			}
+			if s != nil {
+				errs = append(errs, v.validateValue(in, name+"/"+jsonPointerEscaper.Replace(key), s, value[key])...)
+			}
+		}
+	}
+	return errs
+}
+
+// hasJSONType reports whether a value decoded by decodeJSONValue has the JSON type.
+func hasJSONType(value any, typ string) bool {
+	switch value := value.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case string:
+		return typ == "string"
+	case json.Number:
+		_, err := value.Int64()
+		return typ == "number" || (typ == "integer" && err == nil)
+	case []any:
+		return typ == "array"
+	case map[string]any:
+		return typ == "object"
+	}
+	return false
+}
+
+// resolve returns the schema in the components referred to by ref. Any value is allowed if it isn't found.
+func (v *requestValidator) resolve(ref string) *jsonSchema {
+	if s, ok := v.doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; ok {
+		return s
+	}
+	return &jsonSchema{}
+}
+
+// decodeJSONValue decodes JSON keeping numbers as json.Number, so that integers can be told from other numbers.
+func decodeJSONValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// validateResponse checks that the status code and the body of res are documented in op.
+func (v *requestValidator) validateResponse(op *openAPIOperation, res *bufferedResponse) error {
+	resp, ok := op.Responses[strconv.Itoa(res.code)]
+	if !ok {
+		return fmt.Errorf("status %d is not documented", res.code)
+	}
+	if len(resp.Content) == 0 {
+		if res.body.Len() > 0 {
+			return fmt.Errorf("status %d has a body, which is not documented", res.code)
+		}
+		return nil
+	}
+
+	// handlers writing JSON leave Content-Type to be sniffed, so the only documented type is used then
+	mediaType, _, _ := mime.ParseMediaType(res.header.Get("Content-Type"))
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		if len(resp.Content) != 1 {
+			return fmt.Errorf("media type %q of status %d is not documented", mediaType, res.code)
+		}
+		for mediaType, media = range resp.Content {
+		}
+	}
+	if mediaType != "application/json" {
+		return nil
+	}
+
+	value, err := decodeJSONValue(res.body.Bytes())
+	if err != nil {
+		return fmt.Errorf("status %d has an invalid JSON body: %w", res.code, err)
+	}
+	var errs []error
+	for _, e := range v.validateValue("body", "", media.Schema, value) {
+		errs = append(errs, fmt.Errorf("status %d: %s %s", res.code, e.Name, e.Message))
+	}
+	return errors.Join(errs...)
+}
+
+// isStreaming reports whether op responds with a stream of events, or upgrades the connection to another protocol.
+func isStreaming(op *openAPIOperation) bool {
+	if _, ok := op.Responses[strconv.Itoa(http.StatusSwitchingProtocols)]; ok {
+		return true
+	}
+	for _, resp := range op.Responses {
+		if _, ok := resp.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse is an http.ResponseWriter keeping the response to be validated before it is sent.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.code == 0 {
+		b.code = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.code == 0 {
+		b.code = http.StatusOK
+	}
+	return b.body.Write(p)
+}
@@ -0,0 +1,369 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newValidatedMux registers the routes of h with the validation of requests and responses like Server.Run.
+// Responses which don't match the OpenAPI document fail the test.
+func newValidatedMux(t *testing.T, h *Handlers) *http.ServeMux {
+	t.Helper()
+
+	v, err := newRequestValidator(apiOperations)
+	if err != nil {
+		t.Fatalf("failed to build OpenAPI document: %v", err)
+	}
+	v.onResponseError = func(r *http.Request, err error) {
+		t.Errorf("%s %s: the response doesn't match the OpenAPI document: %v", r.Method, r.URL, err)
+	}
+	mux := http.NewServeMux()
+	h.registerRoutes(validatingMux{mux: newVersionedMux(mux), v: v})
+	return mux
+}
+
+// multipartBody builds a multipart form with the fields and a file for each of the image names.
+func multipartBody(t *testing.T, fields map[string]string, images ...string) (io.Reader, string) {
+	t.Helper()
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range images {
+		fw, err := w.CreateFormFile("image", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(name))
+	}
+	w.Close()
+	return &b, w.FormDataContentType()
+}
+
+func TestRequestValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		method string
+		target string
+		// body is sent in JSON unless form is set.
+		body        string
+		contentType string
+		form        map[string]string
+		images      []string
+		want        []ValidationError
+		// code is the status code of the rejected requests, which is 400 unless it is set.
+		code int
+	}{
+		"ok: query": {
+			method: "GET",
+			target: "/items?sort=newest&include_deleted=false",
+		},
+		"ng: query": {
+			method: "GET",
+			target: "/items?sort=name&include_deleted=yes",
+			want: []ValidationError{
+				{In: "query", Name: "sort", Message: "must be one of [id newest]"},
+				{In: "query", Name: "include_deleted", Message: "must be boolean"},
+			},
+		},
+		"ng: path and query": {
+			method: "GET",
+			target: "/items/abc/similar?threshold=65",
+			want: []ValidationError{
+				{In: "path", Name: "id", Message: "must be integer"},
+				{In: "query", Name: "threshold", Message: "must be at most 64"},
+			},
+		},
+		"ng: non-positive ID": {
+			method: "DELETE",
+			target: "/items/0",
+			want:   []ValidationError{{In: "path", Name: "id", Message: "must be at least 1"}},
+		},
+		"ok: JSON body": {
+			method: "POST",
+			target: "/categories",
+			body:   `{"name": "phone", "parent_id": null}`,
+		},
+		"ng: JSON body": {
+			method: "POST",
+			target: "/categories",
+			body:   `{"name": 1, "parent_id": "electronics"}`,
+			want: []ValidationError{
+				{In: "body", Name: "/name", Message: "must be string"},
+				{In: "body", Name: "/parent_id", Message: "must be integer or null"},
+			},
+		},
+		"ng: missing JSON field": {
+			method: "POST",
+			target: "/categories",
+			body:   `{}`,
+			want:   []ValidationError{{In: "body", Name: "/name", Message: "is required"}},
+		},
+		"ng: invalid JSON": {
+			method: "PATCH",
+			target: "/categories/1",
+			body:   `{"name": `,
+			want:   []ValidationError{{In: "body", Message: "must be valid JSON"}},
+		},
+		"ng: array items": {
+			method: "PUT",
+			target: "/items/1/images/order",
+			body:   `{"image_ids": [1, "2", 3.5]}`,
+			want: []ValidationError{
+				{In: "body", Name: "/image_ids/1", Message: "must be integer"},
+				{In: "body", Name: "/image_ids/2", Message: "must be integer"},
+			},
+		},
+		"ng: JSON body too large": {
+			method: "POST",
+			target: "/categories",
+			body:   `{"name": "` + strings.Repeat("a", maxJSONBodySize) + `"}`,
+			want:   []ValidationError{{In: "body", Message: fmt.Sprintf("must be at most %d bytes", maxJSONBodySize)}},
+			code:   http.StatusRequestEntityTooLarge,
+		},
+		"ok: form": {
+			method: "POST",
+			target: "/items",
+			form:   map[string]string{"name": "jacket", "category_id": "1"},
+			images: []string{"a.jpg", "b.jpg"},
+		},
+		"ng: form": {
+			method: "POST",
+			target: "/items",
+			form:   map[string]string{"category_id": "fashion"},
+			want: []ValidationError{
+				{In: "form", Name: "category_id", Message: "must be integer"},
+				{In: "form", Name: "name", Message: "is required"},
+			},
+		},
+		"ok: JSON body of a form endpoint": {
+			method: "POST",
+			target: "/items",
+			body:   `{"name": "jacket", "category_id": 1, "images": ["YS5qcGc="]}`,
+		},
+		"ng: JSON body of a form endpoint": {
+			method: "POST",
+			target: "/items",
+			body:   `{"name": "jacket", "category_id": 1, "images": ["not base64"], "image_ids": "a.jpg"}`,
+			want: []ValidationError{
+				{In: "body", Name: "/image_ids", Message: "must be array"},
+				{In: "body", Name: "/images/0", Message: "must be encoded in base64"},
+			},
+		},
+		"ng: undocumented media type": {
+			method:      "POST",
+			target:      "/items",
+			body:        `name=jacket`,
+			contentType: "application/x-www-form-urlencoded",
+			want:        []ValidationError{{In: "header", Name: "Content-Type", Message: "must be one of application/json, multipart/form-data"}},
+			code:        http.StatusUnsupportedMediaType,
+		},
+		"ok: media type of a JSON-only endpoint isn't checked": {
+			method:      "POST",
+			target:      "/categories",
+			body:        `{"name": "phone"}`,
+			contentType: "application/x-www-form-urlencoded",
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			v, err := newRequestValidator(apiOperations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the handlers are replaced to test the validation only
+			reached := false
+			mux := http.NewServeMux()
+			for pattern := range apiOperations {
+				validatingMux{mux: mux, v: v}.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+					reached = true
+				})
+			}
+
+			var body io.Reader = strings.NewReader(tt.body)
+			contentType := "application/json"
+			if tt.contentType != "" {
+				contentType = tt.contentType
+			}
+			if tt.form != nil {
+				body, contentType = multipartBody(t, tt.form, tt.images...)
+			}
+			req := httptest.NewRequest(tt.method, tt.target, body)
+			req.Header.Set("Content-Type", contentType)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if tt.want == nil {
+				if !reached || rr.Code != http.StatusOK {
+					t.Errorf("expected the request to reach the handler, got %d: %s", rr.Code, rr.Body.String())
+				}
+				return
+			}
+			if reached {
+				t.Error("expected the request to be rejected before the handler")
+			}
+			code := http.StatusBadRequest
+			if tt.code != 0 {
+				code = tt.code
+			}
+			if rr.Code != code {
+				t.Fatalf("expected status code %d, got %d", code, rr.Code)
+			}
+			var resp ValidationErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, resp.Errors); diff != "" {
+				t.Errorf("unexpected errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestResponsesMatchOpenAPI runs requests through the handlers to catch the responses drifting from the document.
+func TestResponsesMatchOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	imgDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(imgDir, "default.jpg"), []byte("default"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	itemRepo, categoryRepo := NewMemoryRepositories()
+	h := &Handlers{imgDirPath: imgDir, itemRepo: itemRepo, categoryRepo: categoryRepo, adminToken: "secret"}
+	mux := newValidatedMux(t, h)
+
+	// the steps run in order, as they refer to the category and the item created by the earlier steps
+	steps := []struct {
+		method      string
+		target      string
+		body        string
+		contentType string
+		form        map[string]string
+		images      []string
+		admin       bool
+		code        int
+	}{
+		{method: "GET", target: "/", code: http.StatusOK},
+		{method: "GET", target: "/openapi.json", code: http.StatusOK},
+		{method: "POST", target: "/categories", body: `{"name": "fashion"}`, code: http.StatusCreated},
+		{method: "POST", target: "/categories", body: `{"name": "Fashion"}`, code: http.StatusConflict},
+		{method: "PATCH", target: "/categories/1", body: `{"name": "clothes"}`, code: http.StatusOK},
+		{method: "GET", target: "/categories", code: http.StatusOK},
+		{method: "GET", target: "/categories/1", code: http.StatusOK},
+		{method: "POST", target: "/items", form: map[string]string{"name": "jacket", "category_id": "1"}, images: []string{"a.jpg", "b.jpg"}, code: http.StatusOK},
+		{method: "GET", target: "/items", code: http.StatusOK},
+		{method: "GET", target: "/items/1", code: http.StatusOK},
+		{method: "GET", target: "/items/2", code: http.StatusNotFound},
+		{method: "GET", target: "/items/1/similar", code: http.StatusOK},
+		{method: "POST", target: "/items/1/images", images: []string{"c.jpg"}, code: http.StatusOK},
+		{method: "PUT", target: "/items/1/images/order", body: `{"image_ids": [3, 1, 2]}`, code: http.StatusOK},
+		{method: "DELETE", target: "/items/1/images/2", code: http.StatusOK},
+		{method: "GET", target: "/categories/1/items?sort=newest", code: http.StatusOK},
+		{method: "GET", target: "/items?sort=bad", code: http.StatusBadRequest},
+		{method: "DELETE", target: "/items/1", code: http.StatusForbidden},
+		{method: "DELETE", target: "/items/1", admin: true, code: http.StatusNoContent},
+		{method: "GET", target: "/items?include_deleted=true", code: http.StatusForbidden},
+		{method: "GET", target: "/items?include_deleted=true", admin: true, code: http.StatusOK},
+		{method: "DELETE", target: "/categories/1", code: http.StatusConflict},
+		{method: "GET", target: "/debug/db/stats", admin: true, code: http.StatusOK},
+		{method: "GET", target: "/images/missing.jpg", code: http.StatusOK},
+		{method: "POST", target: "/uploads", images: []string{"d.jpg"}, code: http.StatusCreated},
+		{method: "POST", target: "/uploads", images: []string{"d.jpg", "e.jpg"}, code: http.StatusBadRequest},
+		{method: "POST", target: "/items", body: fmt.Sprintf(`{"name": "coat", "category_id": 1, "image_ids": ["%x.jpg"]}`, sha256.Sum256([]byte("d.jpg"))), code: http.StatusOK},
+		{method: "POST", target: "/items", body: `{"name": "coat", "category_id": 1, "image_ids": ["../default.jpg"]}`, code: http.StatusBadRequest},
+		{method: "POST", target: "/items", body: `{"name": "hat", "category": "clothes", "images": ["Zi5qcGc="]}`, code: http.StatusOK},
+		{method: "POST", target: "/items", body: `name=hat`, contentType: "text/plain", code: http.StatusUnsupportedMediaType},
+		{method: "GET", target: "/items/2", code: http.StatusOK},
+	}
+	for _, step := range steps {
+		var body io.Reader = strings.NewReader(step.body)
+		contentType := "application/json"
+		if step.contentType != "" {
+			contentType = step.contentType
+		}
+		if step.form != nil || step.images != nil {
+			body, contentType = multipartBody(t, step.form, step.images...)
+		}
+		req := httptest.NewRequest(step.method, step.target, body)
+		req.Header.Set("Content-Type", contentType)
+		if step.admin {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != step.code {
+			t.Errorf("%s %s: expected status code %d, got %d: %s", step.method, step.target, step.code, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	t.Parallel()
+
+	v, err := newRequestValidator(apiOperations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	v.onResponseError = func(r *http.Request, err error) {
+		errs = append(errs, err)
+	}
+
+	cases := map[string]struct {
+		handler http.HandlerFunc
+		code    int
+		want    string
+	}{
+		"undocumented status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			},
+			code: http.StatusTeapot,
+			want: "status 418 is not documented",
+		},
+		"drifted body": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]any{"msg": "hello"})
+			},
+			code: http.StatusOK,
+			want: "status 200: /message is required",
+		},
+	}
+
+	for name, tt := range cases {
+		errs = nil
+		mux := http.NewServeMux()
+		validatingMux{mux: mux, v: v}.HandleFunc("GET /", tt.handler)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if len(errs) != 1 || errs[0].Error() != tt.want {
+			t.Errorf("%s: expected %q, got %v", name, tt.want, errs)
+		}
+		// the response is sent as is
+		if rr.Code != tt.code {
+			t.Errorf("%s: expected status code %d, got %d", name, tt.code, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// apiVersion is a version of the API served under the prefix of its name, e.g. /v1/items.
+// The handlers are shared by the versions, and the responses are converted to the shapes of the version by its encoders,
+// so a version changing the JSON shape of e.g. Item only adds an encoder for *Item.
+type apiVersion struct {
+	// Name is the path prefix without the slash, e.g. "v1".
+	Name string
+	// Encoders convert the response bodies to the shapes of the version, keyed by the types of the bodies.
+	// The bodies of the other types are encoded as is.
+	Encoders map[reflect.Type]func(v any) any
+}
+
+// encode converts v to the shape of the version.
+func (v *apiVersion) encode(body any) any {
+	if enc, ok := v.Encoders[reflect.TypeOf(body)]; ok {
+		return enc(body)
+	}
+	return body
+}
+
+// apiVersions are the versions served by Server.Run. The first one is the default version,
+// which is served at the legacy root paths as well.
+var apiVersions = []*apiVersion{
+	{Name: "v1"},
+}
+
+// defaultAPIVersion returns the version of the legacy root paths.
+func defaultAPIVersion() *apiVersion {
+	return apiVersions[0]
+}
+
+var (
+	// legacyDeprecatedAt is when the root paths were deprecated in favor of /v1.
+	legacyDeprecatedAt = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	// legacySunsetAt is when the root paths will stop responding.
+	legacySunsetAt = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
+
+type apiVersionKey struct{}
+
+// apiVersionFromContext returns the version of the request, which is the default version for the handlers called directly.
+func apiVersionFromContext(ctx context.Context) *apiVersion {
+	if v, ok := ctx.Value(apiVersionKey{}).(*apiVersion); ok {
+		return v
+	}
+	return defaultAPIVersion()
+}
+
+// writeJSON encodes the response body in the shape of the version of the request.
+func writeJSON(w http.ResponseWriter, r *http.Request, body any) error {
+	return json.NewEncoder(w).Encode(apiVersionFromContext(r.Context()).encode(body))
+}
+
+// versionedMux registers every route under the prefix of each version,
+// and at the root paths with the deprecation headers for the clients from before the versioning.
+type versionedMux struct {
+	mux      routeRegistrar
+	versions []*apiVersion
+	// legacy serves the root paths. They aren't registered when it is nil.
+	legacy *apiVersion
+}
+
+// newVersionedMux registers the routes of apiVersions on mux.
+func newVersionedMux(mux routeRegistrar) versionedMux {
+	return versionedMux{mux: mux, versions: apiVersions, legacy: defaultAPIVersion()}
+}
+
+// HandleFunc registers the handler for the unversioned pattern, e.g. "GET /items", under every version.
+func (m versionedMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	method, path, _ := strings.Cut(pattern, " ")
+	for _, v := range m.versions {
+		m.mux.HandleFunc(method+" /"+v.Name+path, withAPIVersion(v, handler))
+	}
+	if m.legacy != nil {
+		m.mux.HandleFunc(pattern, deprecated(m.legacy, withAPIVersion(m.legacy, handler)))
+	}
+}
+
+// withAPIVersion passes the version to the handler in the context of the request.
+func withAPIVersion(v *apiVersion, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+	}
+}
+
+// deprecated sets the Deprecation (RFC 9745) and Sunset (RFC 8594) headers of the legacy root paths,
+// with the link to the same path of the successor version.
+func deprecated(successor *apiVersion, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+		w.Header().Set("Sunset", legacySunsetAt.Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, successor.Name, r.URL.EscapedPath()))
+		next(w, r)
+	}
+}
+
+// versionedOpenAPIDocument lists the paths of doc under the prefix of each version, and at the root as deprecated.
+func versionedOpenAPIDocument(doc *openAPIDocument, versions []*apiVersion) *openAPIDocument {
+	versioned := *doc
+	versioned.Paths = make(map[string]map[string]*openAPIOperation, len(doc.Paths)*(len(versions)+1))
+	for path, ops := range doc.Paths {
+		for _, v := range versions {
+			versioned.Paths["/"+v.Name+path] = ops
+		}
+		legacy := make(map[string]*openAPIOperation, len(ops))
+		for method, op := range ops {
+			deprecatedOp := *op
+			deprecatedOp.Deprecated = true
+			legacy[method] = &deprecatedOp
+		}
+		versioned.Paths[path] = legacy
+	}
+	return &versioned
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionedMux(t *testing.T) {
+	t.Parallel()
+
+	v1 := &apiVersion{Name: "v1"}
+	// v2 renames the name of items to show a version changing the JSON shape
+	v2 := &apiVersion{Name: "v2", Encoders: map[reflect.Type]func(v any) any{
+		reflect.TypeFor[*Item](): func(v any) any {
+			item := v.(*Item)
+			return map[string]any{"id": item.ID, "title": item.Name}
+		},
+	}}
+	mux := http.NewServeMux()
+	versionedMux{mux: mux, versions: []*apiVersion{v1, v2}, legacy: v1}.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, &Item{ID: 1, Name: "jacket"})
+	})
+
+	cases := map[string]struct {
+		target     string
+		want       map[string]any
+		deprecated bool
+	}{
+		"v1": {
+			target: "/v1/items/1",
+			want:   map[string]any{"id": float64(1), "name": "jacket"},
+		},
+		"v2": {
+			target: "/v2/items/1",
+			want:   map[string]any{"id": float64(1), "title": "jacket"},
+		},
+		"legacy root path": {
+			target:     "/items/1",
+			want:       map[string]any{"id": float64(1), "name": "jacket"},
+			deprecated: true,
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.target, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var got map[string]any
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			// only the fields which tell the shapes apart are compared
+			for k := range got {
+				if _, ok := tt.want[k]; !ok {
+					delete(got, k)
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected body (-want +got):\n%s", diff)
+			}
+
+			wantHeaders := map[string]string{"Deprecation": "", "Sunset": "", "Link": ""}
+			if tt.deprecated {
+				wantHeaders = map[string]string{
+					"Deprecation": fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()),
+					"Sunset":      "Sat, 01 May 2027 00:00:00 GMT",
+					"Link":        `</v1/items/1>; rel="successor-version"`,
+				}
+			}
+			for k, want := range wantHeaders {
+				if got := rr.Header().Get(k); got != want {
+					t.Errorf("expected %s %q, got %q", k, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestURLsOfVersion(t *testing.T) {
+	t.Parallel()
+
+	h := &Handlers{publicBaseURL: "https://api.example.com"}
+	v1, v2 := &apiVersion{Name: "v1"}, &apiVersion{Name: "v2"}
+	mux := http.NewServeMux()
+	versionedMux{mux: mux, versions: []*apiVersion{v1, v2}, legacy: v1}.HandleFunc("GET /urls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, map[string]string{
+			"image":  h.imageURL(r.Context(), "a.jpg"),
+			"upload": h.uploadURL(r.Context(), "abc"),
+		})
+	})
+
+	cases := map[string]struct {
+		target string
+		want   map[string]string
+	}{
+		"v1": {
+			target: "/v1/urls",
+			want:   map[string]string{"image": "https://api.example.com/v1/images/a.jpg", "upload": "https://api.example.com/v1/uploads/resumable/abc"},
+		},
+		"v2": {
+			target: "/v2/urls",
+			want:   map[string]string{"image": "https://api.example.com/v2/images/a.jpg", "upload": "https://api.example.com/v2/uploads/resumable/abc"},
+		},
+		"legacy root path": {
+			target: "/urls",
+			want:   map[string]string{"image": "https://api.example.com/v1/images/a.jpg", "upload": "https://api.example.com/v1/uploads/resumable/abc"},
+		},
+	}
+
+	for name, tt := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.target, nil))
+			var got map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected URLs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVersionedOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+
+	doc, err := buildOpenAPIDocument(apiOperations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned := versionedOpenAPIDocument(doc, []*apiVersion{{Name: "v1"}, {Name: "v2"}})
+
+	for pattern := range apiOperations {
+		method, path, _ := strings.Cut(pattern, " ")
+		path = pathParamPattern.ReplaceAllString(path, "{$1}")
+		method = strings.ToLower(method)
+		for _, prefix := range []string{"/v1", "/v2"} {
+			op := versioned.Paths[prefix+path][method]
+			if op == nil || op.Deprecated {
+				t.Errorf("expected %s %s to be documented without deprecation", method, prefix+path)
+			}
+		}
+		if op := versioned.Paths[path][method]; op == nil || !op.Deprecated {
+			t.Errorf("expected %s %s to be documented as deprecated", method, path)
+		}
+		// the unversioned document used by the validator is left as is
+		if doc.Paths[path][method].Deprecated {
+			t.Errorf("expected %s %s not to be deprecated in the original document", method, path)
+		}
+	}
+}
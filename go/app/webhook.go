@@ -0,0 +1,324 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaults of WebhookWorker.
+const (
+	// DefaultWebhookInterval is the interval of polling the outbox.
+	DefaultWebhookInterval = time.Second
+	// DefaultWebhookTimeout bounds each delivery.
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookMaxAttempts is the number of attempts before a delivery is moved to the dead letters,
+	// which spans about a day with the default backoff.
+	DefaultWebhookMaxAttempts = 15
+	DefaultWebhookBackoff     = 10 * time.Second
+	DefaultWebhookMaxBackoff  = 6 * time.Hour
+	DefaultWebhookBatchSize   = 100
+)
+
+// webhookEventTypes are the types of the events which webhooks subscribe to.
+var webhookEventTypes = []string{itemEventCreated, itemEventUpdated, itemEventDeleted}
+
+// webhookSecretPrefix is the prefix of the secrets of Standard Webhooks, which is followed by the key in base64.
+const webhookSecretPrefix = "whsec_"
+
+// WebhookPayload is the body POSTed to the webhooks.
+type WebhookPayload struct {
+	// ID identifies the event. It is the same across the retries, so that receivers can drop the duplicates.
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// Item is the item after the change.
+	Item *Item `json:"item"`
+}
+
+// outboxItemRepository writes the events of the items to the outbox of the webhooks in the transactions of the writes,
+// so that an event is delivered if and only if its write is committed, even if the process stops right after the commit.
+type outboxItemRepository struct {
+	ItemRepository
+	tx TxManager
+	// enqueue writes the event of the item to the outbox in the transaction of ctx.
+	enqueue func(ctx context.Context, eventType string, item *Item) error
+}
+
+func (o *outboxItemRepository) Insert(ctx context.Context, item *Item) error {
+	return o.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := o.ItemRepository.Insert(ctx, item); err != nil {
+			return err
+		}
+		return o.enqueue(ctx, itemEventCreated, item)
+	})
+}
+
+func (o *outboxItemRepository) Delete(ctx context.Context, id int) error {
+	return o.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := o.ItemRepository.Delete(ctx, id); err != nil {
+			return err
+		}
+		return o.enqueueByID(ctx, itemEventDeleted, id)
+	})
+}
+
+func (o *outboxItemRepository) AddImages(ctx context.Context, itemID int, imageNames []string) ([]*ItemImage, error) {
+	var images []*ItemImage
+	err := o.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if images, err = o.ItemRepository.AddImages(ctx, itemID, imageNames); err != nil {
+			return err
+		}
+		return o.enqueueByID(ctx, itemEventUpdated, itemID)
+	})
+	return images, err
+}
+
+func (o *outboxItemRepository) ReorderImages(ctx context.Context, itemID int, imageIDs []int) ([]*ItemImage, error) {
+	var images []*ItemImage
+	err := o.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if images, err = o.ItemRepository.ReorderImages(ctx, itemID, imageIDs); err != nil {
+			return err
+		}
+		return o.enqueueByID(ctx, itemEventUpdated, itemID)
+	})
+	return images, err
+}
+
+func (o *outboxItemRepository) DeleteImage(ctx context.Context, itemID int, imageID int) ([]*ItemImage, error) {
+	var images []*ItemImage
+	err := o.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		if images, err = o.ItemRepository.DeleteImage(ctx, itemID, imageID); err != nil {
+			return err
+		}
+		return o.enqueueByID(ctx, itemEventUpdated, itemID)
+	})
+	return images, err
+}
+
+// enqueueByID reads the item written in the transaction of ctx and enqueues its event.
+func (o *outboxItemRepository) enqueueByID(ctx context.Context, eventType string, id int) error {
+	item, err := o.ItemRepository.GetByID(ctx, strconv.Itoa(id), ItemQuery{IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	return o.enqueue(ctx, eventType, item)
+}
+
+// enqueueWebhookEvent writes the payload of the event of the item to the outbox in the transaction of ctx.
+func (s *Handlers) enqueueWebhookEvent(ctx context.Context, eventType string, item *Item) error {
+	item = cloneItem(item)
+	// the payloads have the shape of the default version whichever version the change was requested with
+	s.setImageURLs(context.WithValue(ctx, apiVersionKey{}, defaultAPIVersion()), item)
+	payload := WebhookPayload{ID: rand.Text(), Type: eventType, Timestamp: currentTime(), Item: item}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.webhookRepo.Enqueue(ctx, payload.ID, eventType, body)
+}
+
+// newWebhookSecret generates the secret of a webhook in the format of Standard Webhooks.
+func newWebhookSecret() string {
+	key := make([]byte, 24)
+	rand.Read(key)
+	return webhookSecretPrefix + base64.StdEncoding.EncodeToString(key)
+}
+
+// signWebhook returns the signature of a payload in the format of Standard Webhooks (https://www.standardwebhooks.com),
+// which is the HMAC-SHA256 of "<id>.<timestamp>.<body>" in base64 with the version, e.g. "v1,K5oZ...".
+func signWebhook(secret, id string, timestamp time.Time, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, webhookSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook secret: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// WebhookWorker delivers the events in the outbox to the webhooks.
+// A delivery is retried with exponential backoff until the webhook responds with 2xx,
+// and it is moved to the dead letters after MaxAttempts attempts.
+// The deliveries are claimed from the repository, so that several workers may run on the same database.
+type WebhookWorker struct {
+	Repo   WebhookRepository
+	Client *http.Client
+	// Timeout bounds each delivery, which is DefaultWebhookTimeout when it is zero.
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts before a delivery is moved to the dead letters.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, which doubles on each retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// BatchSize is the number of the deliveries claimed at once, which are sent concurrently.
+	BatchSize int
+}
+
+// WebhookWorkerResult is the result of a run of WebhookWorker.
+type WebhookWorkerResult struct {
+	Delivered int
+	// Retried is the number of the failed deliveries which will be retried.
+	Retried int
+	// Dead is the number of the failed deliveries which were moved to the dead letters.
+	Dead int
+}
+
+// claimed returns the number of the deliveries of the run.
+func (r *WebhookWorkerResult) claimed() int {
+	return r.Delivered + r.Retried + r.Dead
+}
+
+// timeout returns the bound of each delivery.
+func (w *WebhookWorker) timeout() time.Duration {
+	if w.Timeout == 0 {
+		return DefaultWebhookTimeout
+	}
+	return w.Timeout
+}
+
+// claimLease returns how long the claimed deliveries are hidden from the other workers.
+// A batch is sent concurrently, so it takes at most the timeout, and the rest of the lease is left to record the attempts.
+// The deliveries of a worker which stopped are retried after it.
+func (w *WebhookWorker) claimLease() time.Duration {
+	return 2 * w.timeout()
+}
+
+// Run delivers the deliveries which are due, up to BatchSize.
+func (w *WebhookWorker) Run(ctx context.Context) (*WebhookWorkerResult, error) {
+	deliveries, err := w.Repo.ClaimDue(ctx, time.Now(), w.claimLease(), w.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	deliverErrs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for n, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliverErrs[n] = w.deliver(ctx, d)
+		}()
+	}
+	wg.Wait()
+
+	result := &WebhookWorkerResult{}
+	var errs []error
+	for n, d := range deliveries {
+		deliverErr := deliverErrs[n]
+		if deliverErr == nil {
+			result.Delivered++
+			errs = append(errs, w.record(d, w.Repo.MarkDelivered(ctx, d.ID, d.ClaimToken)))
+			continue
+		}
+
+		attempts := d.Attempts + 1
+		dead := attempts >= w.MaxAttempts
+		if dead {
+			result.Dead++
+			slog.Warn("webhook delivery moved to dead letters", "id", d.ID, "webhook_id", d.WebhookID, "attempts", attempts, "error", deliverErr)
+		} else {
+			result.Retried++
+		}
+		errs = append(errs, w.record(d, w.Repo.MarkFailed(ctx, d.ID, d.ClaimToken, deliverErr.Error(), time.Now().Add(w.backoff(attempts)), dead)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return result, fmt.Errorf("failed to record webhook deliveries: %w", err)
+	}
+	return result, nil
+}
+
+// record returns the error of recording the attempt of d except errDeliveryNotClaimed,
+// which means that another worker claimed d again after the lease expired and records its own attempt instead.
+// The receiver may get d twice then, and drops the duplicate by Webhook-Id.
+func (w *WebhookWorker) record(d *WebhookDelivery, err error) error {
+	if errors.Is(err, errDeliveryNotClaimed) {
+		slog.Warn("webhook delivery was claimed again before its attempt was recorded", "id", d.ID, "webhook_id", d.WebhookID)
+		return nil
+	}
+	return err
+}
+
+// backoff returns the wait after the failed attempts.
+func (w *WebhookWorker) backoff(attempts int) time.Duration {
+	wait := w.MaxBackoff
+	// the shift is bounded, as it overflows quickly
+	if shift := attempts - 1; shift < 32 {
+		wait = min(w.Backoff<<shift, w.MaxBackoff)
+	}
+	return wait
+}
+
+// deliver POSTs the payload of d to its webhook with the headers of Standard Webhooks.
+func (w *WebhookWorker) deliver(ctx context.Context, d *WebhookDelivery) error {
+	timestamp := time.Now()
+	signature, err := signWebhook(d.Secret, d.EventID, timestamp, d.Payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Webhook-Id", d.EventID)
+	req.Header.Set("Webhook-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set("Webhook-Signature", signature)
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the body is drained so that the connection is reused, but a large one isn't waited for
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// RunPeriodically delivers the deliveries which are due at every interval until ctx is canceled.
+// The batches are run one after another while they are full.
+func (w *WebhookWorker) RunPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				result, err := w.Run(ctx)
+				if err != nil {
+					slog.Error("failed to deliver webhooks: ", "error", err)
+					break
+				}
+				if result.claimed() < w.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an httptest receiver of webhooks, which verifies the signatures
+// and responds with the status codes in order, and with 200 after them.
+type webhookReceiver struct {
+	*httptest.Server
+
+	// delay is how long the receiver takes to respond.
+	delay time.Duration
+
+	mu       sync.Mutex
+	secret   string
+	statuses []int
+	payloads []WebhookPayload
+	// ids are the values of Webhook-Id of every attempt.
+	ids []string
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	t.Helper()
+
+	rcv := &webhookReceiver{secret: secret, statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(rcv.delay)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		timestamp, err := strconv.ParseInt(r.Header.Get("Webhook-Timestamp"), 10, 64)
+		if err != nil {
+			t.Errorf("invalid Webhook-Timestamp: %v", err)
+		}
+		want, err := signWebhook(rcv.secret, r.Header.Get("Webhook-Id"), time.Unix(timestamp, 0), body)
+		if err != nil {
+			t.Error(err)
+		}
+		if got := r.Header.Get("Webhook-Signature"); got != want {
+			t.Errorf("expected signature %q, got %q", want, got)
+		}
+
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+
+		rcv.ids = append(rcv.ids, r.Header.Get("Webhook-Id"))
+		if len(rcv.statuses) > 0 {
+			code := rcv.statuses[0]
+			rcv.statuses = rcv.statuses[1:]
+			w.WriteHeader(code)
+			return
+		}
+		rcv.payloads = append(rcv.payloads, payload)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+// received returns the payloads accepted by the receiver and the IDs of every attempt.
+func (rcv *webhookReceiver) received() ([]WebhookPayload, []string) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]WebhookPayload(nil), rcv.payloads...), append([]string(nil), rcv.ids...)
+}
+
+// runWebhookWorker runs w until no delivery is pending.
+func runWebhookWorker(t *testing.T, w *WebhookWorker, webhookIDs ...int) {
+	t.Helper()
+
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := w.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+		pending := false
+		for _, id := range webhookIDs {
+			deliveries, err := w.Repo.Deliveries(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range deliveries {
+				pending = pending || d.Status == deliveryPending
+			}
+		}
+		if !pending {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the deliveries")
+}
+
+func TestSignWebhook(t *testing.T) {
+	t.Parallel()
+
+	// the example of the specification of Standard Webhooks
+	got, err := signWebhook("whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw", "msg_p5jXN8AQM9LWM0D4loKWxJek", time.Unix(1614265330, 0), []byte(`{"test": 2432232314}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := signWebhook("whsec_not base64", "msg", time.Now(), nil); err == nil {
+		t.Error("expected an error for an invalid secret")
+	}
+}
+
+func TestWebhookWorker(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := NewMemoryWebhookRepository()
+	cases := map[string]struct {
+		statuses     []int
+		eventTypes   []string
+		wantStatus   string
+		wantAttempts int
+		wantError    string
+	}{
+		"delivered": {
+			eventTypes:   []string{itemEventCreated},
+			wantStatus:   deliveryDelivered,
+			wantAttempts: 1,
+		},
+		"retried with backoff": {
+			statuses:     []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			eventTypes:   []string{itemEventCreated},
+			wantStatus:   deliveryDelivered,
+			wantAttempts: 3,
+		},
+		"dead letter": {
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			eventTypes:   []string{itemEventCreated, itemEventDeleted},
+			wantStatus:   deliveryDead,
+			wantAttempts: 3,
+			wantError:    "webhook responded with 503 Service Unavailable",
+		},
+		"other events": {
+			eventTypes: []string{itemEventUpdated},
+		},
+	}
+	receivers := map[string]*webhookReceiver{}
+	webhooks := map[string]*Webhook{}
+	for name, tt := range cases {
+		secret := newWebhookSecret()
+		receivers[name] = newWebhookReceiver(t, secret, tt.statuses...)
+		webhooks[name] = &Webhook{URL: receivers[name].URL, EventTypes: tt.eventTypes, Secret: secret}
+		if err := repo.Create(ctx, webhooks[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	payload, err := json.Marshal(WebhookPayload{ID: "evt_1", Type: itemEventCreated, Item: &Item{ID: 1, Name: "jacket"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Enqueue(ctx, "evt_1", itemEventCreated, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WebhookWorker{Repo: repo, Client: http.DefaultClient, MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, BatchSize: 10}
+	var ids []int
+	for _, webhook := range webhooks {
+		ids = append(ids, webhook.ID)
+	}
+	runWebhookWorker(t, w, ids...)
+
+	for name, tt := range cases {
+		deliveries, err := repo.Deliveries(ctx, webhooks[name].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads, attempts := receivers[name].received()
+		if tt.wantStatus == "" {
+			if len(deliveries) != 0 || len(attempts) != 0 {
+				t.Errorf("%s: expected no deliveries, got %d and %d attempts", name, len(deliveries), len(attempts))
+			}
+			continue
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("%s: expected a delivery, got %d", name, len(deliveries))
+		}
+		d := deliveries[0]
+		if d.Status != tt.wantStatus || d.Attempts != tt.wantAttempts || d.LastError != tt.wantError {
+			t.Errorf("%s: unexpected delivery %+v", name, d)
+		}
+		// the retries have the same ID, so that the receivers can drop the duplicates
+		if len(attempts) != tt.wantAttempts || strings.Count(strings.Join(attempts, ","), "evt_1") != tt.wantAttempts {
+			t.Errorf("%s: expected %d attempts of evt_1, got %v", name, tt.wantAttempts, attempts)
+		}
+		if tt.wantStatus == deliveryDelivered && (len(payloads) != 1 || payloads[0].Item.Name != "jacket") {
+			t.Errorf("%s: unexpected payloads %+v", name, payloads)
+		}
+	}
+}
+
+func TestWebhookWorkersOfSlowReceiver(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	ctx := context.Background()
+	storage := setupSQLiteStorage(t, StorageConfig{})
+	secret := newWebhookSecret()
+	rcv := newWebhookReceiver(t, secret)
+	// the batch would take longer than the lease if it was sent one by one, and the idle worker would claim the rest of it again
+	rcv.delay = 200 * time.Millisecond
+	webhook := &Webhook{URL: rcv.URL, EventTypes: []string{itemEventCreated}, Secret: secret}
+	if err := storage.Webhooks.Create(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+	const events = 5
+	for n := range events {
+		id := "evt_" + strconv.Itoa(n)
+		payload, err := json.Marshal(WebhookPayload{ID: id, Type: itemEventCreated, Item: &Item{ID: n + 1, Name: "jacket"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Webhooks.Enqueue(ctx, id, itemEventCreated, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for n := range 2 {
+		w := &WebhookWorker{Repo: storage.Webhooks, Client: rcv.Client(), Timeout: 400 * time.Millisecond, MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, BatchSize: events}
+		// the first worker claims every delivery, while the second one polls
+		time.Sleep(time.Duration(n) * 50 * time.Millisecond)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the worker runs until the lease of the batch claimed by the other one has expired
+			deadline := time.Now().Add(2 * w.claimLease())
+			for time.Now().Before(deadline) {
+				if _, err := w.Run(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	deliveries, err := storage.Webhooks.Deliveries(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range deliveries {
+		if d.Status != deliveryDelivered || d.Attempts != 1 {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+	}
+	// every event is sent once
+	_, attempts := rcv.received()
+	sent := map[string]int{}
+	for _, id := range attempts {
+		sent[id]++
+	}
+	if len(attempts) != events || len(sent) != events {
+		t.Errorf("expected %d events sent once each, got %v", events, attempts)
+	}
+}
+
+func TestWebhookRepositoryClaims(t *testing.T) {
+	t.Parallel()
+
+	repos := map[string]func(t *testing.T) WebhookRepository{
+		"memory": func(t *testing.T) WebhookRepository { return NewMemoryWebhookRepository() },
+		"sqlite": func(t *testing.T) WebhookRepository {
+			if testing.Short() {
+				t.Skip("skipping e2e test")
+			}
+			return setupSQLiteStorage(t, StorageConfig{}).Webhooks
+		},
+	}
+	for name, newRepo := range repos {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			repo := newRepo(t)
+			if err := repo.Create(ctx, &Webhook{URL: "https://example.com", EventTypes: []string{itemEventCreated}, Secret: newWebhookSecret()}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Enqueue(ctx, "evt_1", itemEventCreated, []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+
+			// the first claim expires, and the delivery is claimed again by another worker
+			now := time.Now()
+			first, err := repo.ClaimDue(ctx, now, time.Second, 10)
+			if err != nil || len(first) != 1 {
+				t.Fatalf("expected a delivery to claim, got %v, %v", first, err)
+			}
+			second, err := repo.ClaimDue(ctx, now.Add(2*time.Second), time.Second, 10)
+			if err != nil || len(second) != 1 {
+				t.Fatalf("expected the expired claim to be claimed again, got %v, %v", second, err)
+			}
+			if first[0].ClaimToken == second[0].ClaimToken {
+				t.Fatalf("expected a new claim token, got %q", second[0].ClaimToken)
+			}
+
+			// only the latest claim records the attempt, once
+			if err := repo.MarkDelivered(ctx, first[0].ID, first[0].ClaimToken); !errors.Is(err, errDeliveryNotClaimed) {
+				t.Errorf("expected %v for the expired claim, got %v", errDeliveryNotClaimed, err)
+			}
+			if err := repo.MarkFailed(ctx, first[0].ID, first[0].ClaimToken, "timeout", now, false); !errors.Is(err, errDeliveryNotClaimed) {
+				t.Errorf("expected %v for the expired claim, got %v", errDeliveryNotClaimed, err)
+			}
+			if err := repo.MarkDelivered(ctx, second[0].ID, second[0].ClaimToken); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.MarkFailed(ctx, second[0].ID, second[0].ClaimToken, "timeout", now, false); !errors.Is(err, errDeliveryNotClaimed) {
+				t.Errorf("expected %v for the delivered delivery, got %v", errDeliveryNotClaimed, err)
+			}
+
+			deliveries, err := repo.Deliveries(ctx, first[0].WebhookID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := deliveries[0]; d.Status != deliveryDelivered || d.Attempts != 1 || d.LastError != "" {
+				t.Errorf("unexpected delivery %+v", d)
+			}
+		})
+	}
+}
+
+func TestWebhookWorkerBackoff(t *testing.T) {
+	t.Parallel()
+
+	w := &WebhookWorker{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	cases := map[int]time.Duration{
+		1:   10 * time.Second,
+		2:   20 * time.Second,
+		3:   40 * time.Second,
+		4:   time.Minute,
+		100: time.Minute,
+	}
+	for attempts, want := range cases {
+		if got := w.backoff(attempts); got != want {
+			t.Errorf("%d attempts: expected %v, got %v", attempts, want, got)
+		}
+	}
+}
+
+func TestOutboxItemRepositoryE2e(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test")
+	}
+
+	ctx := context.Background()
+	storage := setupSQLiteStorage(t, StorageConfig{})
+	h := &Handlers{imgDirPath: t.TempDir(), publicBaseURL: "https://api.example.com", webhookRepo: storage.Webhooks}
+	items := &outboxItemRepository{ItemRepository: storage.Items, tx: storage.Tx, enqueue: h.enqueueWebhookEvent}
+	phone := &Category{Name: "phone"}
+	if err := storage.Categories.Create(ctx, phone); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := newWebhookSecret()
+	rcv := newWebhookReceiver(t, secret, http.StatusBadGateway)
+	webhook := &Webhook{URL: rcv.URL, EventTypes: webhookEventTypes, Secret: secret}
+	if err := storage.Webhooks.Create(ctx, webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events of the writes which are rolled back aren't written to the outbox
+	errFailed := errors.New("failed")
+	err := storage.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := items.Insert(ctx, &Item{Name: "Galaxy", CategoryID: phone.ID, Image: "a.jpg"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected %v, got %v", errFailed, err)
+	}
+	if err := items.Insert(ctx, &Item{Name: "unknown", CategoryID: phone.ID + 100, Image: "b.jpg"}); !errors.Is(err, errCategoryNotFound) {
+		t.Errorf("expected %v, got %v", errCategoryNotFound, err)
+	}
+
+	iphone := &Item{Name: "iPhone", CategoryID: phone.ID, Image: "c.jpg"}
+	if err := items.Insert(ctx, iphone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := items.AddImages(ctx, iphone.ID, []string{"d.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := items.Delete(ctx, iphone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WebhookWorker{Repo: storage.Webhooks, Client: rcv.Client(), MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond, BatchSize: 2}
+	runWebhookWorker(t, w, webhook.ID)
+
+	// the failed delivery is retried after the others
+	payloads, attempts := rcv.received()
+	got := map[string]*Item{}
+	for _, p := range payloads {
+		got[p.Type] = p.Item
+	}
+	if len(payloads) != 3 || len(got) != 3 {
+		t.Fatalf("expected an event of each type, got %+v", payloads)
+	}
+	if len(attempts) != 4 {
+		t.Errorf("expected a retry after the failure, got %d attempts", len(attempts))
+	}
+	if created := got[itemEventCreated]; created.Name != "iPhone" || created.ImageURL != "https://api.example.com/v1/images/c.jpg" || len(created.Images) != 1 {
+		t.Errorf("unexpected created item %+v", created)
+	}
+	if updated := got[itemEventUpdated]; len(updated.Images) != 2 || updated.DeletedAt != nil {
+		t.Errorf("unexpected updated item %+v", updated)
+	}
+	if deleted := got[itemEventDeleted]; deleted.DeletedAt == nil {
+		t.Errorf("unexpected deleted item %+v", deleted)
+	}
+
+	deliveries, err := storage.Webhooks.Deliveries(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range deliveries {
+		if d.Status != deliveryDelivered || d.LastError != "" {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+	}
+	// nothing is claimed once everything is delivered
+	if claimed, err := storage.Webhooks.ClaimDue(ctx, time.Now().Add(time.Hour), time.Minute, 10); err != nil || len(claimed) != 0 {
+		t.Errorf("expected no deliveries to claim, got %v, %v", claimed, err)
+	}
+}
@@ -1,20 +1,88 @@
 package main
 
 import (
+	"flag"
+	"log"
 	"mercari-build-training/app"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	port         = "9000"
+	grpcPort     = "9001"
 	imageDirPath = "images"
 )
 
 func main() {
 	// This is the entry point of the application.
 	// You don't need to modify this function.
+	// DB_DRIVER is sqlite3 (default), postgres or memory, and DB_SOURCE is the file path or the connection URL.
+	storage := flag.String("storage", os.Getenv("DB_DRIVER"), "where to store items: sqlite3, postgres or memory (default $DB_DRIVER or sqlite3)")
+	flag.Parse()
+
+	var gcInterval time.Duration
+	if v, found := os.LookupEnv("IMAGE_GC_INTERVAL"); found {
+		var err error
+		gcInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid IMAGE_GC_INTERVAL: %v", err)
+		}
+	}
+
+	var uploadTTL time.Duration
+	if v, found := os.LookupEnv("UPLOAD_TTL"); found {
+		var err error
+		uploadTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid UPLOAD_TTL: %v", err)
+		}
+	}
+
+	var maxOpenConns int
+	if v, found := os.LookupEnv("DB_MAX_OPEN_CONNS"); found {
+		var err error
+		maxOpenConns, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("invalid DB_MAX_OPEN_CONNS: %v", err)
+		}
+	}
+	var connMaxLifetime time.Duration
+	if v, found := os.LookupEnv("DB_CONN_MAX_LIFETIME"); found {
+		var err error
+		connMaxLifetime, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid DB_CONN_MAX_LIFETIME: %v", err)
+		}
+	}
+
+	// CLIENT_TOKENS are the comma-separated bearer tokens of the apps using the WebSocket
+	var clientTokens []string
+	if v := os.Getenv("CLIENT_TOKENS"); v != "" {
+		clientTokens = strings.Split(v, ",")
+	}
+
+	publicBaseURL, found := os.LookupEnv("PUBLIC_BASE_URL")
+	if !found {
+		publicBaseURL = "http://localhost:" + port
+	}
+
 	os.Exit(app.Server{
-		Port:         port,
-		ImageDirPath: imageDirPath,
+		Port:          port,
+		GRPCPort:      grpcPort,
+		ImageDirPath:  imageDirPath,
+		PublicBaseURL: publicBaseURL,
+		AdminToken:    os.Getenv("ADMIN_TOKEN"),
+		ClientTokens:  clientTokens,
+		Storage: app.StorageConfig{
+			Driver:          *storage,
+			Source:          os.Getenv("DB_SOURCE"),
+			MaxOpenConns:    maxOpenConns,
+			ConnMaxLifetime: connMaxLifetime,
+		},
+		ImageGCInterval: gcInterval,
+		UploadTTL:       uploadTTL,
 	}.Run())
 }
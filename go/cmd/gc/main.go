@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mercari-build-training/app"
+	"os"
+)
+
+const imageDirPath = "images"
+
+func main() {
+	// This command removes image files which are no longer referenced by any item.
+	// Run it from the same directory and with the same DB_DRIVER and DB_SOURCE as the api command, e.g. `go run ./cmd/gc -dry-run`.
+	dryRun := flag.Bool("dry-run", false, "list orphaned images without removing them")
+	grace := flag.Duration("grace", app.DefaultImageGCGracePeriod, "keep images modified within this period")
+	flag.Parse()
+
+	driver := os.Getenv("DB_DRIVER")
+	if driver == app.DriverMemory {
+		// the in-memory storage of this process is empty, so every image would look orphaned
+		fmt.Fprintf(os.Stderr, "DB_DRIVER=%s is not supported, as the items of the api command can't be read from another process\n", app.DriverMemory)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	storage, err := app.OpenStorage(ctx, app.StorageConfig{
+		Driver: driver,
+		Source: os.Getenv("DB_SOURCE"),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	gc := &app.ImageGC{
+		ImgDirPath:  imageDirPath,
+		ItemRepo:    storage.Items,
+		GracePeriod: *grace,
+		DryRun:      *dryRun,
+	}
+	result, err := gc.Run(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		storage.Close()
+		os.Exit(1)
+	}
+
+	for _, name := range result.Removed {
+		fmt.Println(name)
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	fmt.Fprintf(os.Stderr, "scanned %d images, %s %d orphaned images\n", result.Scanned, verb, len(result.Removed))
+}
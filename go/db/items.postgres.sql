@@ -0,0 +1,73 @@
+-- the PostgreSQL version of items.sql
+CREATE TABLE IF NOT EXISTS categories (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	name TEXT NOT NULL,
+	slug TEXT NOT NULL UNIQUE,
+	parent_id BIGINT REFERENCES categories (id)
+);
+
+CREATE TABLE IF NOT EXISTS items (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	name TEXT NOT NULL,
+	category_id BIGINT NOT NULL REFERENCES categories (id),
+	image_name TEXT NOT NULL,
+	phash BIGINT,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS item_images (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	item_id BIGINT NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+	image_name TEXT NOT NULL,
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_event_types (
+	webhook_id BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	PRIMARY KEY (webhook_id, event_type)
+);
+
+-- the outbox has a row per event and webhook, which is written in the transaction of the change of the item
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	webhook_id BIGINT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	-- pending, delivered or dead
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	last_error TEXT,
+	-- the token of the latest claim, which the attempt is recorded with
+	claim_token TEXT,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+-- category names are unique case-insensitively like COLLATE NOCASE of SQLite
+CREATE UNIQUE INDEX IF NOT EXISTS categories_name_idx ON categories (LOWER(name));
+-- for GET /categories/{id}/items, which walks the tree and filters items by category
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+CREATE INDEX IF NOT EXISTS items_category_id_idx ON items (category_id);
+-- for GET /items?sort=newest
+CREATE INDEX IF NOT EXISTS items_created_at_idx ON items (created_at);
+-- for searching items by a substring of their names with LOWER(name) LIKE '%keyword%',
+-- which a B-tree index can't serve
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS items_name_trgm_idx ON items USING GIN (LOWER(name) gin_trgm_ops);
+-- for loading the images of items in order
+CREATE INDEX IF NOT EXISTS item_images_item_id_position_idx ON item_images (item_id, position);
+-- for finding the webhooks of an event
+CREATE INDEX IF NOT EXISTS webhook_event_types_event_type_idx ON webhook_event_types (event_type);
+-- for claiming the deliveries which are due
+CREATE INDEX IF NOT EXISTS webhook_outbox_status_next_attempt_at_idx ON webhook_outbox (status, next_attempt_at);
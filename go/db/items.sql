@@ -1,11 +1,71 @@
+CREATE TABLE IF NOT EXISTS categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL COLLATE NOCASE UNIQUE,
+	slug TEXT NOT NULL UNIQUE,
+	parent_id INTEGER REFERENCES categories (id)
+);
+
 CREATE TABLE IF NOT EXISTS items (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	name TEXT NOT NULL,
-	category_id INTEGER NOT NULL,
-	image_name TEXT NOT NULL
+	category_id INTEGER NOT NULL REFERENCES categories (id),
+	image_name TEXT NOT NULL,
+	phash INTEGER,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	deleted_at DATETIME
 );
 
-CREATE TABLE IF NOT EXISTS categories (
+CREATE TABLE IF NOT EXISTS item_images (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	item_id INTEGER NOT NULL REFERENCES items (id) ON DELETE CASCADE,
+	image_name TEXT NOT NULL,
+	position INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	name TEXT NOT NULL
-);
\ No newline at end of file
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_event_types (
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_type TEXT NOT NULL,
+	PRIMARY KEY (webhook_id, event_type)
+);
+
+-- the outbox has a row per event and webhook, which is written in the transaction of the change of the item
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	-- pending, delivered or dead
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	next_attempt_at DATETIME NOT NULL,
+	last_error TEXT,
+	-- the token of the latest claim, which the attempt is recorded with
+	claim_token TEXT,
+	created_at DATETIME NOT NULL
+);
+
+-- for GET /categories/{id}/items, which walks the tree and filters items by category
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+CREATE INDEX IF NOT EXISTS items_category_id_idx ON items (category_id);
+-- for GET /items?sort=newest
+CREATE INDEX IF NOT EXISTS items_created_at_idx ON items (created_at);
+-- for loading the images of items in order
+CREATE INDEX IF NOT EXISTS item_images_item_id_position_idx ON item_images (item_id, position);
+-- for finding the webhooks of an event
+CREATE INDEX IF NOT EXISTS webhook_event_types_event_type_idx ON webhook_event_types (event_type);
+-- for claiming the deliveries which are due
+CREATE INDEX IF NOT EXISTS webhook_outbox_status_next_attempt_at_idx ON webhook_outbox (status, next_attempt_at);
+
+-- items created before item_images existed keep their single image as the cover
+INSERT INTO item_images (item_id, image_name, position)
+SELECT id, image_name, 0 FROM items
+WHERE id NOT IN (SELECT item_id FROM item_images);